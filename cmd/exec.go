@@ -17,6 +17,7 @@ package cmd
 import (
 	//"fmt"
 	//"io/ioutil"
+	"os"
 
 	"github.com/spf13/cobra"
 
@@ -24,26 +25,55 @@ import (
 
 	"github.com/uthng/jobflow/config"
 	"github.com/uthng/jobflow/job"
+	"github.com/uthng/jobflow/report"
 
 	// import all jobflow builtin modules
 	_ "github.com/uthng/jobflow/plugins/all"
 )
 
 var (
-	jobexec   string
-	inventory string
-	verbosity int
+	jobexec     string
+	inventories []string
+	limit       string
+	verbosity   int
+	forks       int
+	check       bool
+
+	reportFormat string
+	reportFile   string
+
+	stateFile   string
+	resumeFile  string
+	forceResume bool
+
+	vars      []string
+	varsFiles []string
+	debugVars bool
 )
 
 // execCmd represents the exec command
 var execCmd = &cobra.Command{
 	Use:   "exec",
 	Short: "Exec command is to execute jobs",
-	Long:  `Exec command is to execute a specific job. If no job specified, all jobs will get executed in the order.`,
+	Long:  `Exec command is to execute a specific job. If no job specified, all jobs will get executed following their needs.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		log.SetVerbosity(verbosity)
 
-		exec(args)
+		jf := exec(args)
+		if debugVars {
+			return
+		}
+
+		if reportFormat != "" {
+			err := writeReport(jf)
+			if err != nil {
+				log.Fatalw("Cannot write report", "format", reportFormat, "file", reportFile, "err", err)
+			}
+		}
+
+		if jf.Status == job.FAILED {
+			os.Exit(1)
+		}
 	},
 }
 
@@ -55,8 +85,19 @@ func init() {
 	// Cobra supports Persistent Flags which will work for this command
 	// and all subcommands, e.g.:
 	execCmd.PersistentFlags().StringVar(&jobexec, "job", "all", "Job's name. Default: all")
-	execCmd.PersistentFlags().StringVar(&inventory, "inventory", "", "Inventory file")
+	execCmd.PersistentFlags().StringArrayVar(&inventories, "inventory", nil, "Inventory source: YAML, INI or JSON file, executable script, ssh config or Terraform state, optionally prefixed with its type such as ssh:~/.ssh/config. Can be repeated to merge sources")
+	execCmd.PersistentFlags().StringVar(&limit, "limit", "", "Host pattern restricting the hosts of remote jobs, such as web:&prod or all:!canary")
 	execCmd.PersistentFlags().IntVar(&verbosity, "verbosity", log.INFO, "Log level. Default: INFO")
+	execCmd.PersistentFlags().IntVar(&forks, "forks", 0, "Maximum number of hosts executed at the same time. Default: flow forks or no limit")
+	execCmd.PersistentFlags().BoolVar(&check, "check", false, "Check mode: commands report the actions they would perform and those not supporting it are skipped")
+	execCmd.PersistentFlags().StringVar(&reportFormat, "report", "", "Report format written at the end of the run: json, junit or markdown")
+	execCmd.PersistentFlags().StringVar(&reportFile, "report-file", "", "Report file. Default: standard output, task output being then printed on the standard error")
+	execCmd.PersistentFlags().StringVar(&stateFile, "state", "", "State file in which task results are saved to resume the flow")
+	execCmd.PersistentFlags().StringVar(&resumeFile, "resume", "", "State file of a previous run. Tasks succeeded in it are not executed again")
+	execCmd.PersistentFlags().BoolVar(&forceResume, "force", false, "Resume even if the flow file changed since the state was saved")
+	execCmd.PersistentFlags().StringArrayVar(&vars, "var", nil, "Variable key=value overriding all other variables. Can be repeated")
+	execCmd.PersistentFlags().StringArrayVar(&varsFiles, "vars-file", nil, "YAML file of variables overriding task vars. Can be repeated")
+	execCmd.PersistentFlags().BoolVar(&debugVars, "debug-vars", false, "Print the variables of each job on each host with their source, without executing jobs")
 
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
@@ -69,18 +110,138 @@ func exec(args []string) *job.Flow {
 		log.Fatalln("No jobflow file is specified")
 	}
 
+	if reportFormat != "" {
+		err := report.CheckFormat(reportFormat)
+		if err != nil {
+			log.Fatalw("Invalid report format", "err", err)
+		}
+	}
+
+	config.SetVault(loadVault(vaultPasswordFile, false))
+
 	jf := config.ReadFlowFile(args[0])
 
-	if inventory != "" {
-		jf.Inventory = config.ReadInventoryFile(inventory)
+	if len(inventories) > 0 {
+		jf.Inventory = config.ReadInventorySources(inventories)
+	}
+
+	if forks > 0 {
+		jf.Forks = forks
+	}
+
+	jf.Limit = limit
+
+	jf.Check = check
+
+	// Task output must not be mixed with a report written
+	// on the standard output
+	if reportFormat != "" && reportFile == "" {
+		jf.OnOutput = job.PrintOutputStderr
+	}
+
+	readExtraVars(jf)
+
+	if debugVars {
+		err := jf.PrintVariables(os.Stdout)
+		if err != nil {
+			log.Fatalw("Cannot print variables", "err", err)
+		}
+
+		return jf
 	}
 
+	resumeFlow(jf)
+
 	//Execute all jobs
 	if jobexec == "all" {
-		log.Debugw("List of jobs", "jobs", jf.Jobs)
-
-		jf.RunAllJobs()
+		err := jf.RunAllJobs()
+		if err != nil {
+			log.Errorw("Flow failed", "err", err)
+		}
 	}
 
 	return jf
 }
+
+// readExtraVars reads the vars files and the variables of the command
+// line. Vars files are applied in their order, then the variables
+func readExtraVars(jf *job.Flow) {
+	for _, file := range varsFiles {
+		layer, err := config.ReadVarsFile(file)
+		if err != nil {
+			log.Fatalw("Cannot read vars file", "file", file, "err", err)
+		}
+
+		jf.ExtraVars = append(jf.ExtraVars, layer)
+	}
+
+	if len(vars) > 0 {
+		layer, err := config.ParseVars(vars)
+		if err != nil {
+			log.Fatalw("Invalid variable", "err", err)
+		}
+
+		jf.ExtraVars = append(jf.ExtraVars, layer)
+	}
+}
+
+// resumeFlow sets the state of the previous run to resume
+// and saves the state of the run in the state file.
+// The state file is the resumed one if it is not specified.
+func resumeFlow(jf *job.Flow) {
+	file := stateFile
+
+	if resumeFile != "" {
+		state, err := job.ReadStateFile(resumeFile)
+		if err != nil {
+			log.Fatalw("Cannot read state file", "file", resumeFile, "err", err)
+		}
+
+		if state.FlowHash != jf.Hash {
+			if !forceResume {
+				log.Fatalw("Flow file changed since the state was saved, use --force to resume anyway", "file", resumeFile)
+			}
+
+			log.Warnw("Flow file changed since the state was saved", "file", resumeFile)
+		}
+
+		jf.Resume = state
+
+		if file == "" {
+			file = resumeFile
+		}
+	}
+
+	// Tasks are not really executed in check mode
+	// so they must not be resumed afterwards
+	if file != "" && jf.Check {
+		log.Warnw("State file not saved in check mode", "file", file)
+		return
+	}
+
+	if file != "" {
+		jf.AddObserver(job.NewStateFile(file, jf.Hash, jf.Resume))
+	}
+}
+
+// writeReport writes the report of the flow run
+// in the report file or on the standard output
+func writeReport(jf *job.Flow) error {
+	r := report.New(jf)
+
+	if reportFile == "" {
+		return r.Write(os.Stdout, reportFormat)
+	}
+
+	f, err := os.Create(reportFile)
+	if err != nil {
+		return err
+	}
+
+	err = r.Write(f, reportFormat)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
@@ -3,10 +3,12 @@ package cmd
 import (
 	//"fmt"
 	"os"
+	"reflect"
 	"testing"
 	//    "reflect"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/uthng/jobflow/job"
 	//log "github.com/uthng/golog"
 )
 
@@ -54,10 +56,32 @@ func TestExec(t *testing.T) {
 			args = append(args, tc.yamlFile)
 
 			jf := exec(args)
-			for i, j := range jf.Jobs {
-				assert.Equal(t, tc.output[i], j.Result)
+			assert.Equal(t, job.SUCCESS, jf.Status)
+			assert.Equal(t, len(tc.output), len(jf.Result["localhost"]))
+
+			// Jobs are stored in the order of their execution
+			for i, j := range jf.Result["localhost"] {
+				for name, result := range tc.output[i] {
+					assert.Equal(t, result, j.Result[name].Result)
+				}
 			}
 		})
 	}
 
 }
+
+func TestExecReportOutput(t *testing.T) {
+	os.Setenv("VAR1", "var1")
+	os.Setenv("VAR2", "var2")
+
+	defer func() { reportFormat, reportFile = "", "" }()
+
+	// Task output goes to stderr when the report is on stdout
+	reportFormat = "json"
+	jf := exec([]string{"./data/exec.yml"})
+	assert.Equal(t, reflect.ValueOf(job.PrintOutputStderr).Pointer(), reflect.ValueOf(jf.OnOutput).Pointer())
+
+	reportFile = os.DevNull
+	jf = exec([]string{"./data/exec.yml"})
+	assert.Equal(t, reflect.ValueOf(job.PrintOutput).Pointer(), reflect.ValueOf(jf.OnOutput).Pointer())
+}
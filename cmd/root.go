@@ -51,6 +51,7 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is .jobflow.yaml)")
+	rootCmd.PersistentFlags().StringVar(&vaultPasswordFile, "vault-password-file", "", "File containing the vault password. Default: $"+vaultPasswordEnv)
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	log "github.com/uthng/golog"
+
+	"github.com/uthng/jobflow/vault"
+)
+
+// vaultPasswordEnv is the environment variable
+// containing the vault password
+const vaultPasswordEnv = "JOBFLOW_VAULT_PASSWORD"
+
+var (
+	vaultPasswordFile    string
+	newVaultPasswordFile string
+	encryptStrings       bool
+)
+
+// vaultCmd represents the vault command
+var vaultCmd = &cobra.Command{
+	Use:   "vault",
+	Short: "Vault command is to encrypt and decrypt files or values",
+	Long: `Vault command is to encrypt and decrypt flow files, inventory files or values with AES-256-GCM.
+The key is derived from the password given by --vault-password-file or by the environment variable ` + vaultPasswordEnv + `.`,
+}
+
+var vaultEncryptCmd = &cobra.Command{
+	Use:   "encrypt FILE...",
+	Short: "Encrypt files, or values with --string",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		v := loadVault(vaultPasswordFile, true)
+
+		if encryptStrings {
+			for _, arg := range args {
+				encrypted, err := v.EncryptString(arg)
+				if err != nil {
+					log.Fatalw("Cannot encrypt value", "err", err)
+				}
+
+				fmt.Print(formatEncryptedValue(encrypted))
+			}
+
+			return
+		}
+
+		for _, file := range args {
+			err := rewriteFile(file, func(content []byte) ([]byte, error) {
+				if vault.IsEncrypted(content) {
+					return nil, fmt.Errorf("file already encrypted")
+				}
+
+				return v.Encrypt(content)
+			})
+			if err != nil {
+				log.Fatalw("Cannot encrypt file", "file", file, "err", err)
+			}
+		}
+	},
+}
+
+var vaultDecryptCmd = &cobra.Command{
+	Use:   "decrypt FILE...",
+	Short: "Decrypt files",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		v := loadVault(vaultPasswordFile, true)
+
+		for _, file := range args {
+			err := rewriteFile(file, v.Decrypt)
+			if err != nil {
+				log.Fatalw("Cannot decrypt file", "file", file, "err", err)
+			}
+		}
+	},
+}
+
+var vaultEditCmd = &cobra.Command{
+	Use:   "edit FILE",
+	Short: "Edit an encrypted file with $EDITOR",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		v := loadVault(vaultPasswordFile, true)
+
+		err := rewriteFile(args[0], func(content []byte) ([]byte, error) {
+			plain, err := v.Decrypt(content)
+			if err != nil {
+				return nil, err
+			}
+
+			plain, err = editContent(plain)
+			if err != nil {
+				return nil, err
+			}
+
+			return v.Encrypt(plain)
+		})
+		if err != nil {
+			log.Fatalw("Cannot edit file", "file", args[0], "err", err)
+		}
+	},
+}
+
+var vaultRekeyCmd = &cobra.Command{
+	Use:   "rekey FILE...",
+	Short: "Encrypt files again with the password of --new-vault-password-file",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if newVaultPasswordFile == "" {
+			log.Fatalw("No new vault password file is specified")
+		}
+
+		v := loadVault(vaultPasswordFile, true)
+		newVault := loadVault(newVaultPasswordFile, true)
+
+		for _, file := range args {
+			err := rewriteFile(file, func(content []byte) ([]byte, error) {
+				plain, err := v.Decrypt(content)
+				if err != nil {
+					return nil, err
+				}
+
+				return newVault.Encrypt(plain)
+			})
+			if err != nil {
+				log.Fatalw("Cannot rekey file", "file", file, "err", err)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(vaultCmd)
+
+	vaultCmd.AddCommand(vaultEncryptCmd)
+	vaultCmd.AddCommand(vaultDecryptCmd)
+	vaultCmd.AddCommand(vaultEditCmd)
+	vaultCmd.AddCommand(vaultRekeyCmd)
+
+	vaultEncryptCmd.Flags().BoolVar(&encryptStrings, "string", false, "Encrypt the values given instead of files and print them")
+	vaultRekeyCmd.Flags().StringVar(&newVaultPasswordFile, "new-vault-password-file", "", "File containing the new vault password")
+}
+
+// loadVault returns the vault using the password of the file given
+// or of the environment variable. If no password is found, it exits
+// if the vault is required, otherwise it returns nil.
+func loadVault(file string, required bool) *vault.Vault {
+	var password []byte
+
+	if file != "" {
+		var err error
+
+		password, err = vault.ReadPasswordFile(file)
+		if err != nil {
+			log.Fatalw("Cannot read vault password file", "file", file, "err", err)
+		}
+	} else {
+		password = []byte(os.Getenv(vaultPasswordEnv))
+	}
+
+	if len(password) == 0 {
+		if required {
+			log.Fatalw("No vault password: use --vault-password-file or " + vaultPasswordEnv)
+		}
+
+		return nil
+	}
+
+	v, err := vault.New(password)
+	if err != nil {
+		log.Fatalw("Cannot create vault", "err", err)
+	}
+
+	return v
+}
+
+// rewriteFile replaces the content of the file by
+// the one returned by the function given
+func rewriteFile(file string, fn func([]byte) ([]byte, error)) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	content, err = fn(content)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, content, info.Mode())
+}
+
+// editContent writes the content in a temporary file, opens it
+// with the editor of $EDITOR or vi and returns the content saved
+func editContent(content []byte) ([]byte, error) {
+	tmp, err := ioutil.TempFile("", "jobflow-vault-")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(content)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+
+	// Editor may contain arguments such as "code --wait"
+	fields := strings.Fields(editor)
+
+	cmd := osexec.Command(fields[0], append(fields[1:], tmp.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadFile(tmp.Name())
+}
+
+// formatEncryptedValue formats an encrypted value as a YAML
+// block scalar to paste after the key of a variable
+func formatEncryptedValue(encrypted string) string {
+	lines := strings.Split(strings.TrimSpace(encrypted), "\n")
+
+	return "|\n  " + strings.Join(lines, "\n  ") + "\n"
+}
@@ -1,11 +1,14 @@
 package config
 
 import (
-	//"fmt"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"strconv"
+	"time"
 
 	"github.com/spf13/cast"
-	"gopkg.in/yaml.v2"
 
 	log "github.com/uthng/golog"
 	"github.com/uthng/jobflow/job"
@@ -32,18 +35,18 @@ func ReadFlowFile(file string) *job.Flow {
 // ReadFlow unmarshals the content of the configuration file
 // into Config struct
 func ReadFlow(jf *job.Flow, content []byte) {
-	config := make(map[string]interface{})
-
 	// Get config under map[string]interface{}
 	//content, err := ioutil.ReadFile("testdata/hello")
 	//if err != nil {
 	//log.Fatalw("Cannot read flow file", "file", file, "err", err)
 	//}
 
-	err := yaml.Unmarshal(content, &config)
-	if err != nil {
-		log.Fatalw("Cannot unmarshal flow file content", "err", err)
-	}
+	// Included files are relative to the flow file. The hash
+	// covers the content of all files read
+	h := sha256.New()
+	config := readIncludedFlow(jf.InventoryFile, content, []string{jf.InventoryFile}, map[string]bool{}, h).toConfig()
+
+	jf.Hash = fmt.Sprintf("%x", h.Sum(nil))
 
 	v, ok := config["on_remote"]
 	if ok {
@@ -52,11 +55,64 @@ func ReadFlow(jf *job.Flow, content []byte) {
 
 	v, ok = config["variables"]
 	if ok {
-		jf.Variables = cast.ToStringMap(v)
+		jf.Variables = decryptVars(cast.ToStringMap(v), "variables")
+	}
+
+	// Inventory data of the host given by the local
+	// jobflow to a remote one
+	v, ok = config["host"]
+	if ok {
+		jf.Host = cast.ToStringMap(v)
+	}
+
+	v, ok = config["hostvars"]
+	if ok {
+		jf.HostVars = cast.ToStringMap(v)
+	}
+
+	// Extra variables given by the local jobflow to a remote
+	// one, merged from vars files and the command line
+	v, ok = config["extra_vars"]
+	if ok {
+		jf.ExtraVars = []job.VarLayer{{Source: "extra vars", Vars: cast.ToStringMap(v)}}
+	}
+
+	// Values of secret variables and of params whose names match
+	// secret patterns are masked in logs and outputs
+	v, ok = config["secrets"]
+	if ok {
+		secrets, err := cast.ToStringSliceE(v)
+		if err != nil {
+			log.Fatalw("Invalid flow secrets", "secrets", v, "err", err)
+		}
+
+		jf.Secrets = secrets
+	}
+
+	v, ok = config["secret_patterns"]
+	if ok {
+		patterns, err := cast.ToStringSliceE(v)
+		if err != nil {
+			log.Fatalw("Invalid flow secret patterns", "secret_patterns", v, "err", err)
+		}
+
+		jf.SecretPatterns = patterns
+	}
+
+	v, ok = config["forks"]
+	if ok {
+		forks, err := cast.ToIntE(v)
+		if err != nil || forks < 0 {
+			log.Fatalw("Invalid flow forks", "forks", v)
+		}
+
+		jf.Forks = forks
 	}
 
 	v, ok = config["jobs"]
 	if ok {
+		errs := []error{}
+
 		for i, e := range cast.ToSlice(v) {
 			data := cast.ToStringMap(e)
 
@@ -69,11 +125,20 @@ func ReadFlow(jf *job.Flow, content []byte) {
 			j := job.NewJob(name)
 
 			// Parse tasks
-			readJob(j, cast.ToStringMap(e))
+			errs = append(errs, readJob(j, cast.ToStringMap(e))...)
 
 			// Add job to job list
 			jf.Jobs = append(jf.Jobs, j)
 		}
+
+		// Report all invalid params before failing
+		for _, err := range errs {
+			log.Errorw("Invalid task param", "err", err)
+		}
+
+		if len(errs) > 0 {
+			log.Fatalw("Invalid task params in the flow file", "file", jf.InventoryFile, "errors", len(errs))
+		}
 	} else {
 		log.Fatalw("No section 'jobs' found in the flow file", "file", jf.InventoryFile)
 	}
@@ -81,8 +146,10 @@ func ReadFlow(jf *job.Flow, content []byte) {
 
 ////////////// INTERNAL FUNCTIONS ////////////////////////
 
-// readJob parses & fills up Job structure
-func readJob(j *job.Job, data map[string]interface{}) {
+// readJob parses & fills up Job structure.
+// It returns the errors of task params checked against
+// the specification of their command.
+func readJob(j *job.Job, data map[string]interface{}) []error {
 	hosts := cast.ToString(data["hosts"])
 	if hosts == "" {
 		j.Hosts = "localhost"
@@ -90,12 +157,136 @@ func readJob(j *job.Job, data map[string]interface{}) {
 		j.Hosts = hosts
 	}
 
+	if v, ok := data["timeout"]; ok {
+		timeout, err := readDuration(v)
+		if err != nil {
+			log.Fatalw("Invalid job timeout", "job", j.Name, "err", err)
+		}
+
+		j.Timeout = timeout
+	}
+
+	if v, ok := data["max_parallel"]; ok {
+		maxParallel, err := cast.ToIntE(v)
+		if err != nil || maxParallel < 0 {
+			log.Fatalw("Invalid job max_parallel", "job", j.Name, "max_parallel", v)
+		}
+
+		j.MaxParallel = maxParallel
+	}
+
+	j.FailFast = cast.ToBool(data["fail_fast"])
+
+	if v, ok := data["variables"]; ok {
+		j.Variables = decryptVars(cast.ToStringMap(v), "job "+j.Name)
+	}
+
+	if v, ok := data["needs"]; ok {
+		j.Needs = cast.ToStringSlice(v)
+	}
+
+	// Serial is a batch size or a list of batch sizes
+	if v, ok := data["serial"]; ok {
+		sizes, err := cast.ToSliceE(v)
+		if err != nil {
+			sizes = []interface{}{v}
+		}
+
+		for _, size := range sizes {
+			str := cast.ToString(size)
+
+			_, _, err := job.ParseSerial(str)
+			if err != nil {
+				log.Fatalw("Invalid job serial", "job", j.Name, "err", err)
+			}
+
+			j.Serial = append(j.Serial, str)
+		}
+	}
+
+	if v, ok := data["max_fail_percentage"]; ok {
+		percent, err := cast.ToFloat64E(v)
+		if err != nil || percent < 0 || percent > 100 {
+			log.Fatalw("Invalid job max_fail_percentage", "job", j.Name, "max_fail_percentage", v)
+		}
+
+		j.MaxFailPercentage = percent
+	}
+
+	// Results of a previous run given by the local
+	// jobflow to resume the job on a remote host
+	if v, ok := data["resume"]; ok {
+		resume := make(map[string]*job.CmdResult)
+
+		err := json.Unmarshal([]byte(cast.ToString(v)), &resume)
+		if err != nil {
+			log.Fatalw("Invalid job resume", "job", j.Name, "err", err)
+		}
+
+		j.Resume = resume
+	}
+
 	//Read tasks
 	tasks := cast.ToSlice(data["tasks"])
 	if len(tasks) <= 0 {
 		log.Warnw("No tasks specified", "job", j.Name)
 	}
 
+	list := readTasks(j, "task-", tasks)
+
+	// Tasks of a job with dependencies are executed as a graph,
+	// they must not be chained
+	chain := true
+	for _, task := range list {
+		if len(task.DependsOn) > 0 {
+			chain = false
+			break
+		}
+	}
+
+	for i, task := range list {
+		// If OnSuccess of the previous task is not specified
+		// so set it to the current task. Like that, all tasks
+		// can be executed in case of onsuccess not specified
+		if chain && i > 0 && j.Tasks[i-1].OnSuccess == "" {
+			j.Tasks[i-1].OnSuccess = task.Name
+		}
+
+		j.AddTask(task)
+	}
+
+	// Read tasks executed whatever the result of the job
+	j.Always = readTasks(j, "always-", cast.ToSlice(data["always"]))
+
+	errs := checkTaskParams(j, j.Tasks)
+	errs = append(errs, checkTaskParams(j, j.Always)...)
+
+	return errs
+}
+
+// checkTaskParams checks params of tasks, including tasks of
+// groups, against the specification of their command
+func checkTaskParams(j *job.Job, tasks []*job.Task) []error {
+	errs := []error{}
+
+	for _, task := range tasks {
+		for _, err := range task.Cmd.CheckParams(task.Params) {
+			errs = append(errs, fmt.Errorf("job %s: task %s: %v", j.Name, task.Name, err))
+		}
+
+		for _, list := range [][]*job.Task{task.Block, task.Rescue, task.Always} {
+			errs = append(errs, checkTaskParams(j, list)...)
+		}
+	}
+
+	return errs
+}
+
+// readTasks parses a list of tasks. Tasks without name are
+// named with the prefix followed by their position
+func readTasks(j *job.Job, prefix string, tasks []interface{}) []*job.Task {
+	list := []*job.Task{}
+
 	for i, t := range tasks {
 		task := &job.Task{}
 
@@ -106,10 +297,20 @@ func readJob(j *job.Job, data map[string]interface{}) {
 			task.Name = cast.ToString(n)
 			delete(tm, "name")
 		} else {
-			task.Name = "task-" + cast.ToString(i+1)
+			task.Name = prefix + cast.ToString(i+1)
 		}
 
+		// Read options such as timeout, retries etc.
+		readTaskOptions(j, task, tm)
+
+		// Read block, rescue and always of a group
+		readTaskGroup(j, task, tm)
+
 		for k, v := range tm {
+			if task.Block != nil {
+				log.Fatalw("A task with a block cannot have a command", "job", j.Name, "task", task.Name, "plugin", k)
+			}
+
 			vm := cast.ToStringMap(v)
 
 			plugin := k
@@ -127,13 +328,6 @@ func readJob(j *job.Job, data map[string]interface{}) {
 				log.Fatalw("No parameter is specified", "plugin", plugin)
 			}
 
-			// If OnSuccess of the previous task is not specified
-			// so set it to the current task. Like that, all tasks
-			// can be executed in case of onsuccess not specified
-			if i > 0 && j.Tasks[i-1].OnSuccess == "" {
-				j.Tasks[i-1].OnSuccess = task.Name
-			}
-
 			c, ok := job.GetCmdByName(plugin + "." + cmd)
 			if !ok {
 				log.Fatalw("No command found", "cmd", cmd, "plugin", plugin)
@@ -142,6 +336,159 @@ func readJob(j *job.Job, data map[string]interface{}) {
 			task.Cmd = c
 		}
 
-		j.AddTask(task)
+		list = append(list, task)
+	}
+
+	return list
+}
+
+// readTaskGroup parses the block, rescue and always tasks of
+// a group and removes them from the task map
+func readTaskGroup(j *job.Job, task *job.Task, tm map[string]interface{}) {
+	v, ok := tm["block"]
+	if !ok {
+		if _, ok := tm["rescue"]; ok {
+			log.Fatalw("Rescue requires a block", "job", j.Name, "task", task.Name)
+		}
+		if _, ok := tm["always"]; ok {
+			log.Fatalw("Always requires a block", "job", j.Name, "task", task.Name)
+		}
+
+		return
+	}
+
+	if task.Loop != nil {
+		log.Fatalw("A task with a block cannot loop", "job", j.Name, "task", task.Name)
+	}
+
+	task.Block = readTasks(j, task.Name+"-block-", cast.ToSlice(v))
+	if len(task.Block) == 0 {
+		log.Fatalw("Block is empty", "job", j.Name, "task", task.Name)
+	}
+
+	task.Rescue = readTasks(j, task.Name+"-rescue-", cast.ToSlice(tm["rescue"]))
+	task.Always = readTasks(j, task.Name+"-always-", cast.ToSlice(tm["always"]))
+
+	delete(tm, "block")
+	delete(tm, "rescue")
+	delete(tm, "always")
+}
+
+// readTaskOptions parses the task attributes other than name
+// and plugin, and removes them from the task map
+func readTaskOptions(j *job.Job, task *job.Task, tm map[string]interface{}) {
+	var err error
+
+	if v, ok := tm["depends_on"]; ok {
+		task.DependsOn = cast.ToStringSlice(v)
+		delete(tm, "depends_on")
+	}
+
+	if v, ok := tm["timeout"]; ok {
+		task.Timeout, err = readDuration(v)
+		if err != nil {
+			log.Fatalw("Invalid task timeout", "job", j.Name, "task", task.Name, "err", err)
+		}
+
+		delete(tm, "timeout")
+	}
+
+	if v, ok := tm["retries"]; ok {
+		task.Retries, err = cast.ToIntE(v)
+		if err != nil || task.Retries < 0 {
+			log.Fatalw("Invalid task retries", "job", j.Name, "task", task.Name, "retries", v)
+		}
+
+		delete(tm, "retries")
+	}
+
+	if v, ok := tm["delay"]; ok {
+		task.Delay, err = readDuration(v)
+		if err != nil {
+			log.Fatalw("Invalid task delay", "job", j.Name, "task", task.Name, "err", err)
+		}
+
+		delete(tm, "delay")
+	}
+
+	if v, ok := tm["backoff"]; ok {
+		task.Backoff = cast.ToString(v)
+		if task.Backoff != job.BackoffFixed && task.Backoff != job.BackoffExponential {
+			log.Fatalw("Invalid task backoff", "job", j.Name, "task", task.Name, "backoff", task.Backoff)
+		}
+
+		delete(tm, "backoff")
+	}
+
+	if v, ok := tm["until"]; ok {
+		task.Until = cast.ToString(v)
+		delete(tm, "until")
+	}
+
+	if v, ok := tm["when"]; ok {
+		task.When = cast.ToString(v)
+		delete(tm, "when")
+	}
+
+	if v, ok := tm["vars"]; ok {
+		task.Vars = decryptVars(cast.ToStringMap(v), "task "+task.Name)
+		delete(tm, "vars")
+	}
+
+	// with_items is an alias of loop
+	for _, k := range []string{"loop", "with_items"} {
+		if v, ok := tm[k]; ok {
+			if task.Loop != nil {
+				log.Fatalw("Only one of loop or with_items can be specified", "job", j.Name, "task", task.Name)
+			}
+
+			task.Loop = v
+			delete(tm, k)
+		}
+	}
+
+	if v, ok := tm["loop_parallel"]; ok {
+		task.LoopParallel, err = cast.ToIntE(v)
+		if err != nil || task.LoopParallel < 0 {
+			log.Fatalw("Invalid task loop_parallel", "job", j.Name, "task", task.Name, "loop_parallel", v)
+		}
+
+		delete(tm, "loop_parallel")
+	}
+
+	if v, ok := tm["break_on_error"]; ok {
+		task.BreakOnError = cast.ToBool(v)
+		delete(tm, "break_on_error")
+	}
+
+	if v, ok := tm["register"]; ok {
+		task.Register = cast.ToString(v)
+		delete(tm, "register")
 	}
 }
+
+// readDuration converts a duration given in the flow file.
+//
+// A number without unit is a number of seconds, otherwise
+// it must be a duration string such as "1m30s".
+func readDuration(v interface{}) (time.Duration, error) {
+	str := cast.ToString(v)
+	if str == "" {
+		return 0, fmt.Errorf("duration is empty")
+	}
+
+	var d time.Duration
+	var err error
+
+	if secs, e := strconv.ParseFloat(str, 64); e == nil {
+		d = time.Duration(secs * float64(time.Second))
+	} else if d, err = time.ParseDuration(str); err != nil {
+		return 0, err
+	}
+
+	if d < 0 {
+		return 0, fmt.Errorf("duration is negative: %s", str)
+	}
+
+	return d, nil
+}
@@ -6,6 +6,7 @@ import (
 	//"fmt"
 	//"reflect"
 	"testing"
+	"time"
 
 	//"github.com/spf13/cast"
 	"github.com/stretchr/testify/assert"
@@ -18,54 +19,125 @@ import (
 
 func TestReadFlowFile(t *testing.T) {
 	var yamlFlowFile = []byte(`
+forks: 5
+
+secrets: [var2]
+secret_patterns: [apikey]
+
 variables:
   var1: $VAR1
   var2: ${VAR2}
 
 jobs:
 - name: build
+  timeout: 10m
+  max_parallel: 2
+  fail_fast: true
+  resume: '{"task-1": {"Status": 1, "Result": {"result": "10"}}}'
   tasks:
-  - shell:
+  - timeout: 30
+    when: "{{ .context.variables.var1 }}"
+    with_items: [a, b]
+    loop_parallel: 2
+    break_on_error: true
+    register: echo_output
+    shell:
      cmd: exec
      params:
        cmd: echo 10
-  - shell:
+  - retries: 3
+    delay: 2s
+    backoff: exponential
+    depends_on: [task-1]
+    until: "{{ .current.Result.result }}"
+    shell:
       cmd: exec
       params:
         cmd: echo 20
 
 - hosts: swmmng
+  needs: [build]
+  serial: [1, 25%]
+  max_fail_percentage: 10
   tasks:
   - name: "github release"
     github:
       cmd: release
       params:
-        target: hello
+        token: $GITHUB_TOKEN
+        user: uthng
+        repository: jobflow
+        version: "{{ .context.variables.var1 }}"
+        commitish: master
+        name: jobflow
+        draft: true
+  - name: deploy
+    block:
+    - shell:
+        cmd: exec
+        params:
+          cmd: deploy
+    rescue:
+    - shell:
+        cmd: exec
+        params:
+          cmd: rollback
+    always:
+    - shell:
+        cmd: exec
+        params:
+          cmd: notify
+  always:
+  - name: cleanup
+    shell:
+      cmd: exec
+      params:
+        cmd: rm -rf /tmp/build
 `)
 
 	//cmdFuncShellExec, _ := job.GetCmdByName("shell.exec")
 	//cmdFuncGithubRelease, _ := job.GetCmdByName("github.release")
 
 	flowOK := &job.Flow{
+		Forks: 5,
 		Variables: map[string]interface{}{
 			"var1": "$VAR1",
 			"var2": "${VAR2}",
 		},
 		Jobs: []*job.Job{
 			{
-				Name:  "build",
-				Hosts: "localhost",
+				Name:    "build",
+				Hosts:   "localhost",
+				Timeout: 10 * time.Minute,
+
+				MaxParallel: 2,
+				FailFast:    true,
+
+				MaxFailPercentage: -1,
+
 				Tasks: []*job.Task{
 					{
-						Name: "task-1",
+						Name:    "task-1",
+						Timeout: 30 * time.Second,
+						When:    "{{ .context.variables.var1 }}",
+
+						Loop:         []interface{}{"a", "b"},
+						LoopParallel: 2,
+						BreakOnError: true,
+						Register:     "echo_output",
 						//Func: cmdFuncShellExec.Func,
 						Params: map[string]interface{}{
 							"cmd": "echo 10",
 						},
-						OnSuccess: "task-2",
 					},
 					{
-						Name: "task-2",
+						Name:    "task-2",
+						Retries: 3,
+						Delay:   2 * time.Second,
+						Backoff: job.BackoffExponential,
+
+						DependsOn: []string{"task-1"},
+						Until:     "{{ .current.Result.result }}",
 						//Func: cmdFuncShellExec.Func,
 						Params: map[string]interface{}{
 							"cmd": "echo 20",
@@ -76,15 +148,33 @@ jobs:
 			{
 				Name:  "job-2",
 				Hosts: "swmmng",
+				Needs: []string{"build"},
+
+				Serial:            []string{"1", "25%"},
+				MaxFailPercentage: 10,
 				Tasks: []*job.Task{
 					{
 						Name: "github release",
 						//Func: cmdFuncGithubRelease.Func,
 						Params: map[string]interface{}{
-							"target": "hello",
+							"token":      "$GITHUB_TOKEN",
+							"user":       "uthng",
+							"repository": "jobflow",
+							"version":    "{{ .context.variables.var1 }}",
+							"commitish":  "master",
+							"name":       "jobflow",
+							"draft":      true,
 						},
+						OnSuccess: "deploy",
+					},
+					{
+						Name:   "deploy",
+						Block:  []*job.Task{{Name: "deploy-block-1"}},
+						Rescue: []*job.Task{{Name: "deploy-rescue-1"}},
+						Always: []*job.Task{{Name: "deploy-always-1"}},
 					},
 				},
+				Always: []*job.Task{{Name: "cleanup"}},
 			},
 		},
 	}
@@ -94,6 +184,10 @@ jobs:
 	ReadFlow(jf, yamlFlowFile)
 
 	assert.Equal(t, flowOK.Variables, jf.Variables)
+	assert.Equal(t, flowOK.Forks, jf.Forks)
+	assert.Len(t, jf.Hash, 64)
+	assert.Equal(t, []string{"var2"}, jf.Secrets)
+	assert.Equal(t, []string{"apikey"}, jf.SecretPatterns)
 
 	expectedJobs := make(map[string]interface{})
 	actualJobs := make(map[string]interface{})
@@ -108,12 +202,23 @@ jobs:
 
 	assert.Equal(t, len(expectedJobs), len(actualJobs))
 
+	// Results of a previous run are restored on remote hosts
+	assert.Equal(t, job.SUCCESS, jf.Jobs[0].Resume["task-1"].Status)
+	assert.Equal(t, "10", jf.Jobs[0].Resume["task-1"].Result["result"])
+
 	for k, v := range expectedJobs {
 		expected := v.(*job.Job)
 		actual := actualJobs[k].(*job.Job)
 
 		assert.Equal(t, expected.Name, actual.Name)
 		assert.Equal(t, expected.Hosts, actual.Hosts)
+		assert.Equal(t, expected.Timeout, actual.Timeout)
+		assert.Equal(t, expected.MaxParallel, actual.MaxParallel)
+		assert.Equal(t, expected.FailFast, actual.FailFast)
+		assert.Equal(t, expected.Needs, actual.Needs)
+		assert.Equal(t, expected.Serial, actual.Serial)
+		assert.Equal(t, expected.MaxFailPercentage, actual.MaxFailPercentage)
+		assert.Equal(t, taskNames(expected.Always), taskNames(actual.Always))
 
 		expectedTasks := make(map[string]interface{})
 		actualTasks := make(map[string]interface{})
@@ -134,7 +239,75 @@ jobs:
 			assert.Equal(t, expected.Params, actual.Params)
 			assert.Equal(t, expected.OnSuccess, actual.OnSuccess)
 			assert.Equal(t, expected.OnFailure, actual.OnFailure)
+			assert.Equal(t, expected.Timeout, actual.Timeout)
+			assert.Equal(t, expected.Retries, actual.Retries)
+			assert.Equal(t, expected.Delay, actual.Delay)
+			assert.Equal(t, expected.Backoff, actual.Backoff)
+			assert.Equal(t, expected.Until, actual.Until)
+			assert.Equal(t, expected.DependsOn, actual.DependsOn)
+			assert.Equal(t, expected.When, actual.When)
+			assert.Equal(t, expected.Loop, actual.Loop)
+			assert.Equal(t, expected.LoopParallel, actual.LoopParallel)
+			assert.Equal(t, expected.BreakOnError, actual.BreakOnError)
+			assert.Equal(t, expected.Register, actual.Register)
+			assert.Equal(t, taskNames(expected.Block), taskNames(actual.Block))
+			assert.Equal(t, taskNames(expected.Rescue), taskNames(actual.Rescue))
+			assert.Equal(t, taskNames(expected.Always), taskNames(actual.Always))
 			//assert.Equal(t, expected.Result, actual.Result)
 		}
 	}
 }
+
+func taskNames(tasks []*job.Task) []string {
+	names := []string{}
+	for _, task := range tasks {
+		names = append(names, task.Name)
+	}
+
+	return names
+}
+
+func TestReadFlowDependsOn(t *testing.T) {
+	var yamlFlowFile = []byte(`
+jobs:
+- name: build
+  tasks:
+  - name: compile
+    shell:
+      cmd: exec
+      params:
+        cmd: echo compile
+  - name: test
+    depends_on: [compile]
+    shell:
+      cmd: exec
+      params:
+        cmd: echo test
+  - name: package
+    depends_on: [compile]
+    shell:
+      cmd: exec
+      params:
+        cmd: echo package
+`)
+
+	jf := job.NewFlow()
+
+	ReadFlow(jf, yamlFlowFile)
+
+	// Tasks with dependencies are not chained
+	j := jf.Jobs[0]
+	for _, task := range j.Tasks {
+		assert.Equal(t, "", task.OnSuccess, task.Name)
+	}
+
+	assert.Nil(t, j.CheckTasks())
+
+	err := j.Run("")
+	assert.Nil(t, err)
+	assert.Equal(t, job.SUCCESS, j.Status)
+
+	for _, name := range []string{"compile", "test", "package"} {
+		assert.Equal(t, job.SUCCESS, j.Result[name].Status, name)
+	}
+}
@@ -0,0 +1,419 @@
+package config
+
+import (
+	"hash"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cast"
+	"gopkg.in/yaml.v2"
+
+	log "github.com/uthng/golog"
+)
+
+/////////// DECLARATION OF ALL TYPES //////////////////////////
+
+// includedFlow is the content of a flow file merged with
+// the variables, templates and jobs of the files it includes
+type includedFlow struct {
+	config    map[string]interface{}
+	variables map[string]interface{}
+	secrets   []interface{}
+	patterns  []interface{}
+	templates map[string]*flowSection
+	jobs      []*flowSection
+
+	// varFiles gives the file defining each variable
+	varFiles map[string]string
+}
+
+// flowSection is a job or a job template with the file defining it
+type flowSection struct {
+	name string
+	file string
+	data map[string]interface{}
+}
+
+//////////////// INTERNAL FUNCTIONS ////////////////////
+
+// readIncludedFlow reads the content of a flow file and the files
+// it includes, recursively. Variables of a file override the ones of
+// the files it includes. Jobs and job templates must have unique names.
+//
+// chain is the list of files including the current one, used to
+// detect include cycles. merged is the set of files already read: a
+// file included several times, such as in a diamond, is merged once.
+// The content of all files read is written in the hash given.
+func readIncludedFlow(file string, content []byte, chain []string, merged map[string]bool, h hash.Hash) *includedFlow {
+	content = decryptContent(content, flowFileName(file))
+	h.Write(content)
+
+	config := make(map[string]interface{})
+
+	err := yaml.Unmarshal(content, &config)
+	if err != nil {
+		log.Fatalw("Cannot unmarshal flow file content", "file", flowFileName(file), "err", err)
+	}
+
+	merged[absPath(file)] = true
+
+	flow := &includedFlow{
+		config:    config,
+		variables: make(map[string]interface{}),
+		templates: make(map[string]*flowSection),
+		varFiles:  make(map[string]string),
+	}
+
+	for _, inc := range includeFiles(file, config["include"]) {
+		for _, f := range chain {
+			if sameFile(f, inc) {
+				log.Fatalw("Flow include cycle", "files", strings.Join(append(chain, inc), " -> "))
+			}
+		}
+
+		if merged[absPath(inc)] {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(inc)
+		if err != nil {
+			log.Fatalw("Cannot read included flow file", "file", inc, "included_by", flowFileName(file), "err", err)
+		}
+
+		flow.merge(readIncludedFlow(inc, data, append(chain, inc), merged, h))
+	}
+
+	flow.add(file, config)
+
+	return flow
+}
+
+// includeFiles returns the files matching the include paths of a flow
+// file. Relative paths are relative to the directory of the flow file.
+func includeFiles(file string, include interface{}) []string {
+	if include == nil {
+		return nil
+	}
+
+	paths, err := cast.ToStringSliceE(include)
+	if err != nil {
+		log.Fatalw("Invalid flow include", "file", flowFileName(file), "include", include)
+	}
+
+	files := []string{}
+
+	for _, p := range paths {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(filepath.Dir(file), p)
+		}
+
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			log.Fatalw("Invalid flow include pattern", "file", flowFileName(file), "include", p, "err", err)
+		}
+
+		if len(matches) == 0 {
+			log.Fatalw("No flow file found to include", "file", flowFileName(file), "include", p)
+		}
+
+		files = append(files, matches...)
+	}
+
+	return files
+}
+
+// merge adds the variables, templates and jobs of a flow file included.
+// Jobs and templates declared in several files are reported as errors.
+func (flow *includedFlow) merge(inc *includedFlow) {
+	for k, v := range inc.variables {
+		if file, ok := flow.varFiles[k]; ok {
+			log.Warnw("Variable defined in several included flow files", "variable", k, "files", []string{file, inc.varFiles[k]})
+		}
+
+		flow.variables[k] = v
+		flow.varFiles[k] = inc.varFiles[k]
+	}
+
+	for _, t := range inc.templates {
+		flow.addTemplate(t)
+	}
+
+	for _, j := range inc.jobs {
+		flow.addJob(j)
+	}
+
+	flow.secrets = append(flow.secrets, inc.secrets...)
+	flow.patterns = append(flow.patterns, inc.patterns...)
+}
+
+// add adds the variables, templates and jobs of the flow file
+// itself. Its variables override the ones of the files included
+func (flow *includedFlow) add(file string, config map[string]interface{}) {
+	for k, v := range cast.ToStringMap(config["variables"]) {
+		flow.variables[k] = v
+		flow.varFiles[k] = flowFileName(file)
+	}
+
+	for name, t := range cast.ToStringMap(config["templates"]) {
+		flow.addTemplate(&flowSection{name: name, file: flowFileName(file), data: cast.ToStringMap(t)})
+	}
+
+	for _, j := range cast.ToSlice(config["jobs"]) {
+		data := cast.ToStringMap(j)
+		flow.addJob(&flowSection{name: cast.ToString(data["name"]), file: flowFileName(file), data: data})
+	}
+
+	if v, ok := config["secrets"]; ok {
+		flow.secrets = append(flow.secrets, cast.ToSlice(v)...)
+	}
+
+	if v, ok := config["secret_patterns"]; ok {
+		flow.patterns = append(flow.patterns, cast.ToSlice(v)...)
+	}
+}
+
+// addTemplate adds a job template whose name must be unique. A
+// template of a file included several times is added only once
+func (flow *includedFlow) addTemplate(t *flowSection) {
+	if other, ok := flow.templates[t.name]; ok {
+		if other.file == t.file {
+			return
+		}
+
+		log.Fatalw("Job template declared in several flow files", "template", t.name, "files", []string{other.file, t.file})
+	}
+
+	flow.templates[t.name] = t
+}
+
+// addJob adds a job. Jobs without name cannot collide
+// as they are named from their position afterwards
+func (flow *includedFlow) addJob(j *flowSection) {
+	if j.name != "" {
+		for _, other := range flow.jobs {
+			if other.name == j.name {
+				log.Fatalw("Job declared in several flow files", "job", j.name, "files", []string{other.file, j.file})
+			}
+		}
+	}
+
+	flow.jobs = append(flow.jobs, j)
+}
+
+// toConfig returns the config of the flow file with the variables
+// and the jobs merged. Jobs extending a template are resolved
+func (flow *includedFlow) toConfig() map[string]interface{} {
+	config := make(map[string]interface{}, len(flow.config))
+	for k, v := range flow.config {
+		config[k] = v
+	}
+
+	delete(config, "include")
+	delete(config, "templates")
+
+	if len(flow.variables) > 0 {
+		config["variables"] = flow.variables
+	}
+
+	if len(flow.secrets) > 0 {
+		config["secrets"] = flow.secrets
+	}
+
+	if len(flow.patterns) > 0 {
+		config["secret_patterns"] = flow.patterns
+	}
+
+	if _, ok := config["jobs"]; ok || len(flow.jobs) > 0 {
+		jobs := []interface{}{}
+		for _, j := range flow.jobs {
+			jobs = append(jobs, flow.resolveJob(j))
+		}
+
+		config["jobs"] = jobs
+	}
+
+	return config
+}
+
+// resolveJob returns the job data merged with the template it
+// extends and with the params of its tasks overridden
+func (flow *includedFlow) resolveJob(j *flowSection) map[string]interface{} {
+	data := flow.extend(j, []string{})
+	if _, ok := data["params"]; !ok {
+		return data
+	}
+
+	params := cast.ToStringMap(data["params"])
+	delete(data, "params")
+
+	for task, p := range params {
+		if !overrideTaskParams(data, task, cast.ToStringMap(p)) {
+			log.Fatalw("Task not found to override its params", "job", j.name, "task", task, "file", j.file)
+		}
+	}
+
+	return data
+}
+
+// extend returns a copy of the job or template data merged with the
+// template it extends, recursively. Keys of the data override the ones
+// of the template, except variables and task params which are merged.
+func (flow *includedFlow) extend(s *flowSection, chain []string) map[string]interface{} {
+	name := cast.ToString(s.data["extends"])
+	if name == "" {
+		return copyValue(s.data).(map[string]interface{})
+	}
+
+	t, ok := flow.templates[name]
+	if !ok {
+		log.Fatalw("Job template not found", "template", name, "extended_by", s.name, "file", s.file)
+	}
+
+	for _, c := range chain {
+		if c == name {
+			log.Fatalw("Job template cycle", "templates", strings.Join(append(chain, name), " -> "), "file", t.file)
+		}
+	}
+
+	data := flow.extend(t, append(chain, name))
+
+	for k, v := range s.data {
+		switch k {
+		case "extends":
+		case "variables", "params":
+			data[k] = mergeMaps(cast.ToStringMap(data[k]), cast.ToStringMap(v), k == "params")
+		default:
+			data[k] = copyValue(v)
+		}
+	}
+
+	delete(data, "extends")
+
+	return data
+}
+
+// overrideTaskParams merges the params given into the params of the
+// task with the name given in the tasks or always tasks of the job.
+// Tasks without name are found with their default name.
+func overrideTaskParams(data map[string]interface{}, name string, params map[string]interface{}) bool {
+	found := false
+
+	for _, list := range []string{"tasks", "always"} {
+		prefix := "task-"
+		if list == "always" {
+			prefix = "always-"
+		}
+
+		tasks := cast.ToSlice(data[list])
+
+		for i, t := range tasks {
+			tm := cast.ToStringMap(t)
+
+			taskName := cast.ToString(tm["name"])
+			if taskName == "" {
+				taskName = prefix + cast.ToString(i+1)
+			}
+
+			if taskName != name {
+				continue
+			}
+
+			// The command of a task is the only map with a cmd key
+			for k, v := range tm {
+				cmd := cast.ToStringMap(v)
+				if cmd["cmd"] == nil {
+					continue
+				}
+
+				cmd["params"] = mergeMaps(cast.ToStringMap(cmd["params"]), params, false)
+				tm[k] = cmd
+				found = true
+			}
+
+			tasks[i] = tm
+		}
+
+		data[list] = tasks
+	}
+
+	return found
+}
+
+// mergeMaps returns a new map with the values of the overrides replacing
+// the ones of the base. Maps of values are merged too if deep is true
+func mergeMaps(base, overrides map[string]interface{}, deep bool) map[string]interface{} {
+	res := make(map[string]interface{}, len(base)+len(overrides))
+	for k, v := range base {
+		res[k] = v
+	}
+
+	for k, v := range overrides {
+		if deep {
+			if _, ok := res[k]; ok {
+				res[k] = mergeMaps(cast.ToStringMap(res[k]), cast.ToStringMap(v), false)
+				continue
+			}
+		}
+
+		res[k] = v
+	}
+
+	return res
+}
+
+// copyValue copies recursively maps and lists so that
+// jobs extending a same template do not share them
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, it := range v {
+			res[k] = copyValue(it)
+		}
+
+		return res
+	case map[interface{}]interface{}:
+		res := make(map[interface{}]interface{}, len(v))
+		for k, it := range v {
+			res[k] = copyValue(it)
+		}
+
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, it := range v {
+			res[i] = copyValue(it)
+		}
+
+		return res
+	}
+
+	return value
+}
+
+// sameFile returns true if both paths are the same file
+func sameFile(a, b string) bool {
+	return absPath(a) == absPath(b)
+}
+
+// absPath returns the absolute path of the file,
+// or the path as it is if it cannot be found
+func absPath(file string) string {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return file
+	}
+
+	return abs
+}
+
+// flowFileName returns the name of the flow file
+// used in logs, "flow" if the content has no file
+func flowFileName(file string) string {
+	if file == "" {
+		return "flow"
+	}
+
+	return file
+}
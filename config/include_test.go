@@ -0,0 +1,145 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadFlowInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobflow-include")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"common/vars.yml": `
+variables:
+  registry: docker.io
+  version: "0.1"
+secrets: [token]
+`,
+		"common/release.yml": `
+variables:
+  token: abc
+templates:
+  base:
+    timeout: 10m
+    variables:
+      env: dev
+  release:
+    extends: base
+    tasks:
+    - name: build
+      shell:
+        cmd: exec
+        params:
+          cmd: make
+    - name: publish
+      shell:
+        cmd: exec
+        params:
+          cmd: make publish
+`,
+		"flow.yml": `
+include:
+- common/*.yml
+
+variables:
+  version: "1.0"
+
+jobs:
+- name: release-app
+  extends: release
+  variables:
+    app: app1
+  params:
+    build:
+      cmd: make app
+- name: release-lib
+  extends: release
+  variables:
+    env: prod
+  tasks:
+  - shell:
+      cmd: exec
+      params:
+        cmd: make lib
+`,
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+
+	jf := ReadFlowFile(filepath.Join(dir, "flow.yml"))
+
+	// Variables of the flow file override the included ones
+	assert.Equal(t, map[string]interface{}{"registry": "docker.io", "version": "1.0", "token": "abc"}, jf.Variables)
+	assert.Equal(t, []string{"token"}, jf.Secrets)
+	assert.Len(t, jf.Hash, 64)
+
+	assert.Equal(t, 2, len(jf.Jobs))
+
+	app := jf.Jobs[0]
+	assert.Equal(t, "release-app", app.Name)
+	assert.Equal(t, map[string]interface{}{"env": "dev", "app": "app1"}, app.Variables)
+	assert.Equal(t, 10*60, int(app.Timeout.Seconds()))
+	assert.Equal(t, 2, len(app.Tasks))
+	assert.Equal(t, map[string]interface{}{"cmd": "make app"}, app.Tasks[0].Params)
+	assert.Equal(t, "make publish", app.Tasks[1].Params["cmd"])
+
+	// Tasks of a job override the ones of its template,
+	// which is not modified by other jobs
+	lib := jf.Jobs[1]
+	assert.Equal(t, map[string]interface{}{"env": "prod"}, lib.Variables)
+	assert.Equal(t, 1, len(lib.Tasks))
+	assert.Equal(t, "task-1", lib.Tasks[0].Name)
+	assert.Equal(t, "make lib", lib.Tasks[0].Params["cmd"])
+}
+
+func TestReadFlowIncludeDiamond(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobflow-include")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"d.yml": `
+jobs:
+- name: shared
+  tasks:
+  - shell:
+      cmd: exec
+      params:
+        cmd: make
+`,
+		"b.yml": "include: [d.yml]\n",
+		"c.yml": "include: [d.yml]\n",
+		"flow.yml": `
+include: [b.yml, c.yml]
+
+jobs:
+- name: app
+  needs: [shared]
+  tasks:
+  - shell:
+      cmd: exec
+      params:
+        cmd: make app
+`,
+	}
+
+	for name, content := range files {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	// A file included by several files is merged once
+	jf := ReadFlowFile(filepath.Join(dir, "flow.yml"))
+	assert.Equal(t, 2, len(jf.Jobs))
+	assert.Equal(t, "shared", jf.Jobs[0].Name)
+	assert.Equal(t, "app", jf.Jobs[1].Name)
+}
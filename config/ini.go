@@ -0,0 +1,324 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	log "github.com/uthng/golog"
+
+	"github.com/uthng/jobflow/job"
+)
+
+/////////// DECLARATION OF ALL TYPES //////////////////////////
+
+// iniSource reads an inventory file in the INI format of Ansible
+type iniSource struct {
+	file string
+}
+
+// iniHostRegexp matches a host line of an INI inventory: a host name
+// or range, an optional port and key=value vars
+var iniHostRegexp = regexp.MustCompile(`^(?:[^\s:=\[#;'"-]|\[[^\]\s]*\])(?:[^\s:=\[]|\[[^\]\s]*\])*(:[0-9]+)?(\s+[A-Za-z_][A-Za-z0-9_]*=\S.*)?$`)
+
+// ansibleVars maps the Ansible connection vars to the jobflow ones
+var ansibleVars = map[string]string{
+	"ansible_host":                 "jobflow_ssh_host",
+	"ansible_port":                 "jobflow_ssh_port",
+	"ansible_user":                 "jobflow_ssh_user",
+	"ansible_password":             "jobflow_ssh_pass",
+	"ansible_ssh_private_key_file": "jobflow_ssh_privkey",
+}
+
+////////// DEFINITION OF ALL FUNCTIONS ///////////////////////////
+
+// ReadINIInventory unmarshals an inventory in the INI format of Ansible:
+//
+//	host1 ansible_host=10.0.0.1
+//
+//	[web]
+//	web[01:20].example.com ansible_user=deploy
+//
+//	[web:vars]
+//	app_port=8080
+//
+//	[prod:children]
+//	web
+//
+// Hosts before the first section are in the group "ungrouped" and
+// the vars of the section [all:vars] are the global vars. Ansible
+// connection vars such as ansible_host are mapped to jobflow_ssh_* vars
+func ReadINIInventory(inventory *job.Inventory, content []byte) {
+	err := readINIInventory(inventory, decryptContent(content, "inventory"))
+	if err != nil {
+		log.Fatalw("Cannot parse INI inventory content", "err", err)
+	}
+
+	mergeInventoryVars(inventory)
+}
+
+// Load adds the content of the INI inventory file
+func (s *iniSource) Load(inventory *job.Inventory) error {
+	content, err := ioutil.ReadFile(s.file)
+	if err != nil {
+		return err
+	}
+
+	return readINIInventory(inventory, decryptContent(content, s.file))
+}
+
+//////////////// INTERNAL FUNCTIONS ////////////////////
+
+// readINIInventory adds the global vars, hosts and groups
+// of an INI inventory to the inventory given
+func readINIInventory(inventory *job.Inventory, content []byte) error {
+	group, kind := "ungrouped", ""
+	groupVars := make(map[string]map[string]interface{})
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			group, kind = line[1:len(line)-1], ""
+			if i := strings.LastIndex(group, ":"); i > 0 {
+				group, kind = group[:i], group[i+1:]
+			}
+
+			switch kind {
+			case "", "vars", "children":
+			default:
+				return fmt.Errorf("line %d: invalid section %s", n, line)
+			}
+
+			if group != "all" {
+				addGroup(inventory, job.Group{Name: group, Hosts: []string{}})
+			}
+
+			continue
+		}
+
+		switch kind {
+		case "vars":
+			i := strings.Index(line, "=")
+			if i <= 0 {
+				return fmt.Errorf("line %d: invalid variable %s", n, line)
+			}
+
+			if groupVars[group] == nil {
+				groupVars[group] = make(map[string]interface{})
+			}
+
+			groupVars[group][strings.TrimSpace(line[:i])] = unquoteINIValue(strings.TrimSpace(line[i+1:]))
+		case "children":
+			addGroup(inventory, job.Group{Name: line, Hosts: []string{}})
+			addGroup(inventory, job.Group{Name: group, Children: []string{line}})
+		default:
+			hosts, err := readINIHost(line)
+			if err != nil {
+				return fmt.Errorf("line %d: %v", n, err)
+			}
+
+			names := []string{}
+			for _, h := range hosts {
+				addHost(inventory, h)
+				names = append(names, h.Name)
+			}
+
+			if group != "all" {
+				addGroup(inventory, job.Group{Name: group, Hosts: names})
+			}
+		}
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return err
+	}
+
+	for name, vars := range groupVars {
+		vars = decryptVars(mapAnsibleVars(vars), name)
+
+		if name == "all" {
+			addGlobalVars(inventory, vars)
+			continue
+		}
+
+		addGroup(inventory, job.Group{Name: name, Vars: vars})
+	}
+
+	return nil
+}
+
+// readINIHost returns the hosts of a host line: a host name or range,
+// optionally followed by a port as in host:2222, and inline vars
+func readINIHost(line string) ([]job.Host, error) {
+	fields, err := splitINIFields(line)
+	if err != nil {
+		return nil, err
+	}
+
+	name := fields[0]
+	vars := make(map[string]interface{})
+
+	// The port follows the last range if any
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "]") {
+		port, err := strconv.Atoi(name[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid port of host %s", name)
+		}
+
+		name = name[:i]
+		vars["jobflow_ssh_port"] = port
+	}
+
+	for _, f := range fields[1:] {
+		i := strings.Index(f, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid variable %s of host %s", f, name)
+		}
+
+		vars[f[:i]] = parseINIValue(f[i+1:])
+	}
+
+	names, err := expandHostRange(name)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := []job.Host{}
+	for _, n := range names {
+		h := job.Host{Name: n, Vars: make(map[string]interface{})}
+		for k, v := range decryptVars(mapAnsibleVars(vars), n) {
+			h.Vars[k] = v
+		}
+
+		hosts = append(hosts, h)
+	}
+
+	return hosts, nil
+}
+
+// splitINIFields splits a line on spaces except in quoted values
+func splitINIFields(line string) ([]string, error) {
+	fields := []string{}
+	field := []rune{}
+	quote := rune(0)
+
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+
+			field = append(field, r)
+		case r == '"' || r == '\'':
+			quote = r
+			field = append(field, r)
+		case r == ' ' || r == '\t':
+			if len(field) > 0 {
+				fields = append(fields, string(field))
+				field = []rune{}
+			}
+		default:
+			field = append(field, r)
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %s", line)
+	}
+
+	if len(field) > 0 {
+		fields = append(fields, string(field))
+	}
+
+	return fields, nil
+}
+
+// parseINIValue returns the value of an inline host var. As in
+// Ansible, numbers and booleans are typed unless they are quoted
+func parseINIValue(value string) interface{} {
+	if unquoted := unquoteINIValue(value); unquoted != value {
+		return unquoted
+	}
+
+	var v interface{}
+
+	err := yaml.Unmarshal([]byte(value), &v)
+	if err != nil {
+		return value
+	}
+
+	switch v.(type) {
+	case int, float64, bool:
+		return v
+	}
+
+	return value
+}
+
+// unquoteINIValue removes the quotes around a value if any.
+// Values of vars sections are always strings
+func unquoteINIValue(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+
+	return value
+}
+
+// mapAnsibleVars returns a copy of the vars with the jobflow
+// ssh vars set from the Ansible connection vars. Jobflow vars
+// given explicitly are kept
+func mapAnsibleVars(vars map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(vars))
+	for k, v := range vars {
+		res[k] = v
+	}
+
+	for from, to := range ansibleVars {
+		v, ok := vars[from]
+		if !ok {
+			continue
+		}
+
+		if _, ok := vars[to]; !ok {
+			res[to] = v
+		}
+	}
+
+	return res
+}
+
+// isINIInventory returns true if the content is an inventory in
+// INI format: its first line is a section such as [web] or a host
+// line such as "web1 ansible_host=10.0.0.1". Other contents are
+// YAML, so that YAML errors are reported as such
+func isINIInventory(content []byte) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			return true
+		}
+
+		return iniHostRegexp.MatchString(line)
+	}
+
+	return false
+}
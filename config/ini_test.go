@@ -0,0 +1,118 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/uthng/jobflow/job"
+)
+
+func TestReadINIInventory(t *testing.T) {
+	content := []byte(`
+# Ungrouped hosts
+bastion ansible_host=192.168.1.1 ansible_port=2222
+
+[web]
+web[01:02].example.com ansible_user=deploy
+web03.example.com:2200 app_port=8081 debug=true name="web three"
+
+[db]
+db1 ansible_host=10.0.0.5 ansible_ssh_private_key_file=/keys/db jobflow_ssh_user=dba ansible_user=postgres
+
+[web:vars]
+app_port=8080
+motd = "hello world"
+
+[prod:children]
+web
+db
+
+[prod:vars]
+env=prod
+
+[all:vars]
+ansible_user=admin
+region=eu
+`)
+
+	assert.True(t, isINIInventory(content))
+	assert.False(t, isINIInventory([]byte("hosts:\n  host1:\n")))
+	assert.True(t, isINIInventory([]byte("host1 ansible_host=10.0.0.1\n")))
+	assert.True(t, isINIInventory([]byte("; hosts\nweb[01:03]:2222\n")))
+
+	// Invalid YAML is not INI so that the YAML error is reported
+	assert.False(t, isINIInventory([]byte("hosts:\n  host1: [\n")))
+	assert.False(t, isINIInventory([]byte("---\nglobal: {a: 1\n")))
+	assert.False(t, isINIInventory([]byte("- host1\n")))
+	assert.False(t, isINIInventory([]byte("")))
+
+	// Detected from the content
+	inventory := job.NewInventory()
+	ReadInventory(inventory, content)
+
+	assert.Equal(t, map[string]interface{}{
+		"ansible_user":     "admin",
+		"jobflow_ssh_user": "admin",
+		"region":           "eu",
+	}, inventory.Global)
+
+	assert.Equal(t, []string{"bastion"}, inventory.Groups["ungrouped"].Hosts)
+	assert.Equal(t, []string{"web01.example.com", "web02.example.com", "web03.example.com"}, inventory.Groups["web"].Hosts)
+	assert.Equal(t, []string{"web", "db"}, inventory.Groups["prod"].Children)
+	assert.Equal(t, []string{"prod", "web"}, inventory.Hosts["web01.example.com"].Groups)
+
+	bastion := inventory.Hosts["bastion"].Vars
+	assert.Equal(t, "192.168.1.1", bastion["jobflow_ssh_host"])
+	assert.Equal(t, 2222, bastion["jobflow_ssh_port"])
+	assert.Equal(t, "admin", bastion["jobflow_ssh_user"])
+
+	web := inventory.Hosts["web01.example.com"].Vars
+	assert.Equal(t, "deploy", web["jobflow_ssh_user"])
+	assert.Equal(t, "8080", web["app_port"])
+	assert.Equal(t, "hello world", web["motd"])
+	assert.Equal(t, "prod", web["env"])
+
+	// Inline vars are typed unless quoted
+	web = inventory.Hosts["web03.example.com"].Vars
+	assert.Equal(t, 2200, web["jobflow_ssh_port"])
+	assert.Equal(t, 8081, web["app_port"])
+	assert.Equal(t, true, web["debug"])
+	assert.Equal(t, "web three", web["name"])
+
+	// Jobflow vars given explicitly are kept
+	db := inventory.Hosts["db1"].Vars
+	assert.Equal(t, "10.0.0.5", db["jobflow_ssh_host"])
+	assert.Equal(t, "/keys/db", db["jobflow_ssh_privkey"])
+	assert.Equal(t, "dba", db["jobflow_ssh_user"])
+	assert.Equal(t, "postgres", db["ansible_user"])
+
+	// Invalid content
+	for _, c := range []string{
+		"[web:unknown]\nweb1\n",
+		"[web:vars]\napp_port\n",
+		"web1 app_port\n",
+		"web1:port\n",
+		"web1 name=\"unterminated\n",
+		"web[3:1]\n",
+	} {
+		assert.NotNil(t, readINIInventory(job.NewInventory(), []byte(c)), c)
+	}
+
+	// Detected as a source from the extension or the content
+	dir, err := ioutil.TempDir("", "jobflow-ini")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"hosts.ini", "hosts"} {
+		file := filepath.Join(dir, name)
+		assert.Nil(t, ioutil.WriteFile(file, content, 0644))
+		assert.Equal(t, SourceINI, detectSource(file), name)
+	}
+
+	inventory = ReadInventorySources([]string{filepath.Join(dir, "hosts")})
+	assert.Equal(t, "192.168.1.1", inventory.Hosts["bastion"].Vars["jobflow_ssh_host"])
+}
@@ -3,20 +3,28 @@
 package config
 
 import (
-	//"fmt"
+	"fmt"
 	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/spf13/cast"
 	"gopkg.in/yaml.v2"
 
 	log "github.com/uthng/golog"
-	utils "github.com/uthng/goutils"
 
 	"github.com/uthng/jobflow/job"
 )
 
+// hostRangeRegexp matches a range of host names
+// such as [01:20], [a:f] or [0:10:2]
+var hostRangeRegexp = regexp.MustCompile(`\[([0-9]+|[a-zA-Z]):([0-9]+|[a-zA-Z])(?::([0-9]+))?\]`)
+
 // ReadInventoryFile reads the flow content from a file and
-// create a new instance Inventory
+// create a new instance Inventory. Files with the .ini extension
+// are INI inventories, others are detected from their content
 func ReadInventoryFile(file string) *job.Inventory {
 	content, err := ioutil.ReadFile(file)
 	if err != nil {
@@ -25,36 +33,69 @@ func ReadInventoryFile(file string) *job.Inventory {
 
 	inventory := job.NewInventory()
 
+	if strings.HasSuffix(file, ".ini") {
+		ReadINIInventory(inventory, content)
+		return inventory
+	}
+
 	ReadInventory(inventory, content)
 
 	return inventory
 }
 
-// ReadInventory unmarshals the inventory file
+// ReadInventory unmarshals the inventory file. Its content
+// is in YAML or, if detected so, in the INI format of Ansible
 func ReadInventory(inventory *job.Inventory, content []byte) {
+	content = decryptContent(content, "inventory")
+
+	read := readYAMLInventory
+	if isINIInventory(content) {
+		read = readINIInventory
+	}
+
+	err := read(inventory, content)
+	if err != nil {
+		log.Fatalw("Cannot unmarshal inventory file content", "err", err)
+	}
+
+	mergeInventoryVars(inventory)
+}
+
+////////////// INTERNAL FUNCTIONS ////////////////////////
+
+// readYAMLInventory adds the global vars, hosts and groups
+// of a YAML inventory to the inventory given
+func readYAMLInventory(inventory *job.Inventory, content []byte) error {
 	config := make(map[string]interface{})
 
 	err := yaml.Unmarshal(content, &config)
 	if err != nil {
-		log.Fatalw("Cannot unmarshal inventory file content", "err", err)
+		return err
 	}
 
 	v, ok := config["global"]
 	if ok {
-		inventory.Global = cast.ToStringMap(v)
+		addGlobalVars(inventory, decryptVars(cast.ToStringMap(v), "global"))
 	}
 
 	v, ok = config["hosts"]
 	if ok {
 		// Parse hosts
-		for n, h := range cast.ToStringMap(v) {
-			host := job.Host{
-				Name: n,
-				Vars: make(map[string]interface{}),
+		for pattern, h := range cast.ToStringMap(v) {
+			names, err := expandHostRange(pattern)
+			if err != nil {
+				return err
 			}
 
-			readHost(&host, cast.ToStringMap(h))
-			inventory.Hosts[n] = host
+			for _, n := range names {
+				host := job.Host{
+					Name: n,
+					Vars: make(map[string]interface{}),
+				}
+
+				readHost(&host, cast.ToStringMap(h))
+				addHost(inventory, host)
+			}
 		}
 	}
 
@@ -66,51 +107,339 @@ func ReadInventory(inventory *job.Inventory, content []byte) {
 				Name: n,
 			}
 
-			readGroup(&group, cast.ToStringMap(g))
-			inventory.Groups[n] = group
+			err := readGroup(&group, cast.ToStringMap(g))
+			if err != nil {
+				return err
+			}
 
-			// Merge vars & groups in host
-			for _, h := range group.Hosts {
-				host, ok := inventory.Hosts[h]
-				if !ok {
-					log.Fatalw("Host in the group not found", "host", h, "group", group.Name)
-				}
+			addGroup(inventory, group)
+		}
+	}
+
+	return nil
+}
+
+// readHost parses & fills up Inventory Host structure
+// with the vars declared on the host only
+func readHost(h *job.Host, data map[string]interface{}) {
+	h.Groups = cast.ToStringSlice(data["groups"])
+
+	for k, v := range decryptVars(data, h.Name) {
+		h.Vars[k] = v
+	}
+}
+
+// readGroup parses & fills up Inventory Group structure.
+// Host ranges such as web[01:20] are expanded
+func readGroup(g *job.Group, data map[string]interface{}) error {
+	g.Hosts = []string{}
+
+	for _, pattern := range cast.ToStringSlice(data["hosts"]) {
+		names, err := expandHostRange(pattern)
+		if err != nil {
+			return err
+		}
+
+		g.Hosts = appendNames(g.Hosts, names...)
+	}
+
+	g.Children = cast.ToStringSlice(data["children"])
+	g.Priority = cast.ToInt(data["priority"])
+	g.Vars = decryptVars(cast.ToStringMap(data["vars"]), g.Name)
+
+	return nil
+}
+
+// addGlobalVars adds global vars to the inventory,
+// overriding the ones of the previous sources
+func addGlobalVars(inventory *job.Inventory, vars map[string]interface{}) {
+	for k, v := range vars {
+		inventory.Global[k] = v
+	}
+}
+
+// addHost adds a host to the inventory. A host already known
+// is merged: its vars are overridden and its groups added
+func addHost(inventory *job.Inventory, host job.Host) {
+	if host.Vars == nil {
+		host.Vars = make(map[string]interface{})
+	}
+
+	h, ok := inventory.Hosts[host.Name]
+	if !ok {
+		inventory.Hosts[host.Name] = host
+		return
+	}
+
+	for k, v := range host.Vars {
+		h.Vars[k] = v
+	}
+
+	h.Groups = appendNames(h.Groups, host.Groups...)
+	inventory.Hosts[host.Name] = h
+}
+
+// addGroup adds a group to the inventory. A group already known
+// is merged: its vars are overridden and its hosts added
+func addGroup(inventory *job.Inventory, group job.Group) {
+	g, ok := inventory.Groups[group.Name]
+	if !ok {
+		inventory.Groups[group.Name] = group
+		return
+	}
+
+	if g.Vars == nil {
+		g.Vars = make(map[string]interface{})
+	}
+
+	for k, v := range group.Vars {
+		g.Vars[k] = v
+	}
+
+	if group.Priority != 0 {
+		g.Priority = group.Priority
+	}
+
+	g.Hosts = appendNames(g.Hosts, group.Hosts...)
+	g.Children = appendNames(g.Children, group.Children...)
+	inventory.Groups[group.Name] = g
+}
+
+// mergeInventoryVars adds the groups and their parent groups to
+// their hosts, sorted by precedence, and merges the vars in hosts
+// once all groups are known
+func mergeInventoryVars(inventory *job.Inventory) {
+	depths, err := groupDepths(inventory)
+	if err != nil {
+		log.Fatalw("Invalid inventory groups", "err", err)
+	}
+
+	for _, group := range inventory.Groups {
+		for _, h := range group.Hosts {
+			host, ok := inventory.Hosts[h]
+			if !ok {
+				log.Fatalw("Host in the group not found", "host", h, "group", group.Name)
+			}
+
+			host.Groups = appendNames(host.Groups, group.Name)
+
+			// Update host
+			inventory.Hosts[h] = host
+		}
+	}
+
+	for n, host := range inventory.Hosts {
+		host.Groups = sortGroups(inventory, depths, parentGroups(inventory, host.Groups))
+		host.Vars = hostVars(inventory, host)
+		inventory.Hosts[n] = host
+	}
+}
+
+// groupDepths returns the depth of each group: 0 for groups without
+// parent, otherwise one more than the depth of their deepest parent.
+// Unknown children and cycles between groups are errors
+func groupDepths(inventory *job.Inventory) (map[string]int, error) {
+	parents := make(map[string][]string)
+
+	for _, g := range inventory.Groups {
+		for _, child := range g.Children {
+			if _, ok := inventory.Groups[child]; !ok {
+				return nil, fmt.Errorf("child group %s of group %s not found", child, g.Name)
+			}
+
+			parents[child] = append(parents[child], g.Name)
+		}
+	}
+
+	depths := make(map[string]int)
+
+	var depth func(name string, chain []string) (int, error)
+	depth = func(name string, chain []string) (int, error) {
+		for i, c := range chain {
+			if c == name {
+				return 0, fmt.Errorf("group cycle %s", strings.Join(append(chain[i:], name), " -> "))
+			}
+		}
+
+		if d, ok := depths[name]; ok {
+			return d, nil
+		}
+
+		d := 0
+		for _, p := range parents[name] {
+			pd, err := depth(p, append(chain, name))
+			if err != nil {
+				return 0, err
+			}
+
+			if pd+1 > d {
+				d = pd + 1
+			}
+		}
+
+		depths[name] = d
 
-				vars, err := utils.MapStringMerge(host.Vars, group.Vars)
-				if err != nil {
-					log.Fatalw("Cannot merge group's vars in host's vars", "err", err)
+		return d, nil
+	}
+
+	for name := range inventory.Groups {
+		_, err := depth(name, []string{})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return depths, nil
+}
+
+// parentGroups returns the groups given with all their parent groups
+func parentGroups(inventory *job.Inventory, groups []string) []string {
+	res := append([]string{}, groups...)
+
+	// Groups appended to the list are visited too
+	for i := 0; i < len(res); i++ {
+		for _, g := range inventory.Groups {
+			for _, child := range g.Children {
+				if child == res[i] {
+					res = appendNames(res, g.Name)
 				}
+			}
+		}
+	}
+
+	return res
+}
+
+// sortGroups sorts the groups by precedence, from the lowest to the
+// highest: parent groups before their children, then the groups of
+// lowest priority first and finally by name
+func sortGroups(inventory *job.Inventory, depths map[string]int, groups []string) []string {
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+
+		if depths[a] != depths[b] {
+			return depths[a] < depths[b]
+		}
+
+		pa, pb := inventory.Groups[a].Priority, inventory.Groups[b].Priority
+		if pa != pb {
+			return pa < pb
+		}
 
-				host.Vars = cast.ToStringMap(vars)
-				host.Groups = append(host.Groups, group.Name)
+		return a < b
+	})
 
-				// Update host
-				inventory.Hosts[h] = host
+	return groups
+}
+
+// appendNames appends the names which are not in the list yet
+func appendNames(names []string, add ...string) []string {
+	for _, n := range add {
+		found := false
+		for _, it := range names {
+			if it == n {
+				found = true
+				break
 			}
 		}
+
+		if !found {
+			names = append(names, n)
+		}
 	}
+
+	return names
 }
 
-////////////// INTERNAL FUNCTIONS ////////////////////////
+// hostVars returns the vars of the host merged from the lowest
+// precedence to the highest: default ssh vars, inventory global,
+// vars of the host groups sorted by precedence and the vars
+// declared on the host
+func hostVars(inventory *job.Inventory, host job.Host) map[string]interface{} {
+	vars := map[string]interface{}{
+		"jobflow_ssh_host":    "localhost",
+		"jobflow_ssh_port":    22,
+		"jobflow_ssh_user":    "root",
+		"jobflow_ssh_pass":    "",
+		"jobflow_ssh_privkey": "",
+	}
 
-// readHost parses & fills up Inventory Host structure
-func readHost(h *job.Host, data map[string]interface{}) {
-	// Init default variables for host
-	h.Vars["jobflow_ssh_host"] = "localhost"
-	h.Vars["jobflow_ssh_port"] = 22
-	h.Vars["jobflow_ssh_user"] = "root"
-	h.Vars["jobflow_ssh_pass"] = ""
-	h.Vars["jobflow_ssh_privkey"] = ""
+	for k, v := range inventory.Global {
+		vars[k] = v
+	}
 
-	h.Groups = cast.ToStringSlice(data["groups"])
+	for _, name := range host.Groups {
+		for k, v := range inventory.Groups[name].Vars {
+			vars[k] = v
+		}
+	}
 
-	for k, v := range data {
-		h.Vars[k] = v
+	for k, v := range host.Vars {
+		vars[k] = v
 	}
+
+	return vars
 }
 
-// readGroup parses & fills up Inventory Group structure
-func readGroup(g *job.Group, data map[string]interface{}) {
-	g.Hosts = cast.ToStringSlice(data["hosts"])
-	g.Vars = cast.ToStringMap(data["vars"])
+// expandHostRange expands the ranges of a host pattern such as
+// web[01:20].example.com or db-[a:c]. A range is numeric or
+// alphabetic, with an optional step as in [0:10:2]. Numbers
+// are padded with zeros to the width of the range start
+func expandHostRange(pattern string) ([]string, error) {
+	loc := hostRangeRegexp.FindStringSubmatchIndex(pattern)
+	if loc == nil {
+		return []string{pattern}, nil
+	}
+
+	prefix, suffix := pattern[:loc[0]], pattern[loc[1]:]
+	start, end := pattern[loc[2]:loc[3]], pattern[loc[4]:loc[5]]
+
+	step := 1
+	if loc[6] >= 0 {
+		step = cast.ToInt(pattern[loc[6]:loc[7]])
+		if step <= 0 {
+			return nil, fmt.Errorf("invalid step in host range %s", pattern)
+		}
+	}
+
+	values := []string{}
+
+	startNum, errStart := strconv.Atoi(start)
+	endNum, errEnd := strconv.Atoi(end)
+
+	switch {
+	case errStart == nil && errEnd == nil:
+		if startNum > endNum {
+			return nil, fmt.Errorf("invalid host range %s: %s is after %s", pattern, start, end)
+		}
+
+		for i := startNum; i <= endNum; i += step {
+			values = append(values, fmt.Sprintf("%0*d", len(start), i))
+		}
+	case len(start) == 1 && len(end) == 1 && errStart != nil && errEnd != nil:
+		if start[0] > end[0] {
+			return nil, fmt.Errorf("invalid host range %s: %s is after %s", pattern, start, end)
+		}
+
+		for c := int(start[0]); c <= int(end[0]); c += step {
+			values = append(values, string(rune(c)))
+		}
+	default:
+		return nil, fmt.Errorf("invalid host range %s", pattern)
+	}
+
+	// Following ranges are expanded for each value
+	rest, err := expandHostRange(suffix)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, v := range values {
+		for _, r := range rest {
+			names = append(names, prefix+v+r)
+		}
+	}
+
+	return names, nil
 }
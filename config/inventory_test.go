@@ -78,7 +78,7 @@ groups:
 				Vars: map[string]interface{}{
 					"jobflow_ssh_host":    "host1.com",
 					"jobflow_ssh_port":    25,
-					"jobflow_ssh_user":    "group1user",
+					"jobflow_ssh_user":    "userhost1",
 					"jobflow_ssh_pass":    "passhost1",
 					"jobflow_ssh_privkey": "",
 					"hostvar":             "host1",
@@ -91,7 +91,7 @@ groups:
 				Vars: map[string]interface{}{
 					"jobflow_ssh_host":    "host2.com",
 					"jobflow_ssh_port":    5555,
-					"jobflow_ssh_user":    "group1user",
+					"jobflow_ssh_user":    "userhost2",
 					"jobflow_ssh_pass":    "",
 					"jobflow_ssh_privkey": "privatekeyhost2",
 					"hostvar":             "host2",
@@ -108,8 +108,8 @@ groups:
 					"jobflow_ssh_port":    22,
 					"jobflow_ssh_user":    "root",
 					"jobflow_ssh_pass":    "",
-					"jobflow_ssh_privkey": "privatekeygroup3",
-					"hostvar":             "group3var1",
+					"jobflow_ssh_privkey": "privatekeyhost3",
+					"hostvar":             "host3",
 					"group2var1":          "group2",
 					"group2var2":          "group2",
 				},
@@ -182,3 +182,106 @@ groups:
 		assert.Equal(t, expected.Vars, actual.Vars)
 	}
 }
+
+func TestReadInventoryGroups(t *testing.T) {
+	inventory := job.NewInventory()
+	ReadInventory(inventory, []byte(`
+global:
+  tier: global
+
+hosts:
+  web[01:03].example.com:
+    app: web
+  db-[a:b]:
+  lb:
+    tier: host
+
+groups:
+  prod:
+    children: [web, db]
+    vars:
+      tier: prod
+      env: prod
+  web:
+    hosts: ["web[01:03:2].example.com", web02.example.com, lb]
+    vars:
+      tier: web
+  db:
+    hosts: ["db-[a:b]"]
+    vars:
+      tier: db
+  blue:
+    hosts: [lb]
+    priority: 10
+    vars:
+      color: blue
+  green:
+    hosts: [lb]
+    vars:
+      color: green
+`))
+
+	assert.Equal(t, []string{"web01.example.com", "web03.example.com", "web02.example.com", "lb"}, inventory.Groups["web"].Hosts)
+	assert.Equal(t, []string{"web", "db"}, inventory.Groups["prod"].Children)
+	assert.Equal(t, 10, inventory.Groups["blue"].Priority)
+
+	// Parent groups first, then by priority and name
+	assert.Equal(t, []string{"green", "prod", "blue", "web"}, inventory.Hosts["lb"].Groups)
+	assert.Equal(t, []string{"prod", "db"}, inventory.Hosts["db-a"].Groups)
+
+	// Child group vars override parent ones and host vars all groups
+	assert.Equal(t, "web", inventory.Hosts["web02.example.com"].Vars["tier"])
+	assert.Equal(t, "prod", inventory.Hosts["web02.example.com"].Vars["env"])
+	assert.Equal(t, "web", inventory.Hosts["web03.example.com"].Vars["app"])
+	assert.Equal(t, "db", inventory.Hosts["db-b"].Vars["tier"])
+	assert.Equal(t, "host", inventory.Hosts["lb"].Vars["tier"])
+	assert.Equal(t, "blue", inventory.Hosts["lb"].Vars["color"])
+
+	hosts, err := inventory.MatchHosts("prod:!web")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"db-a", "db-b"}, hosts)
+
+	// Cycles and unknown children
+	inventory = job.NewInventory()
+	inventory.Groups["a"] = job.Group{Name: "a", Children: []string{"b"}}
+	inventory.Groups["b"] = job.Group{Name: "b", Children: []string{"c"}}
+	inventory.Groups["c"] = job.Group{Name: "c", Children: []string{"a"}}
+
+	_, err = groupDepths(inventory)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "group cycle")
+
+	inventory.Groups["c"] = job.Group{Name: "c", Children: []string{"d"}}
+	_, err = groupDepths(inventory)
+	assert.EqualError(t, err, "child group d of group c not found")
+
+	inventory.Groups["c"] = job.Group{Name: "c"}
+	depths, err := groupDepths(inventory)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{"a": 0, "b": 1, "c": 2}, depths)
+}
+
+func TestExpandHostRange(t *testing.T) {
+	tests := []struct {
+		pattern string
+		names   []string
+	}{
+		{"web", []string{"web"}},
+		{"web[1:3]", []string{"web1", "web2", "web3"}},
+		{"web[08:10].com", []string{"web08.com", "web09.com", "web10.com"}},
+		{"web[0:10:5]", []string{"web0", "web5", "web10"}},
+		{"db-[a:c]", []string{"db-a", "db-b", "db-c"}},
+		{"r[1:2]-[a:b]", []string{"r1-a", "r1-b", "r2-a", "r2-b"}},
+	}
+
+	for _, test := range tests {
+		names, err := expandHostRange(test.pattern)
+		assert.Nil(t, err, test.pattern)
+		assert.Equal(t, test.names, names, test.pattern)
+	}
+
+	for _, pattern := range []string{"web[3:1]", "web[1:a]", "web[c:a]", "web[1:3:0]", "web[1:2]-[2:1]"} {
+		_, err := expandHostRange(pattern)
+		assert.NotNil(t, err, pattern)
+	}
+}
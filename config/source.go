@@ -0,0 +1,295 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	log "github.com/uthng/golog"
+
+	"github.com/uthng/jobflow/job"
+)
+
+/////////// DECLARATION OF ALL TYPES //////////////////////////
+
+// InventorySource is a source of inventory hosts and groups.
+//
+// Several sources can be loaded in the same inventory. Hosts and
+// groups found in several sources are merged, the vars of the last
+// source loaded overriding the ones of the previous sources.
+type InventorySource interface {
+	// Load adds the global vars, hosts and groups of the source
+	// to the inventory. Host vars are merged with the vars of their
+	// groups once all sources are loaded
+	Load(inventory *job.Inventory) error
+}
+
+// Inventory source types which can prefix an inventory
+// path, such as "ssh:~/.ssh/config"
+const (
+	SourceYAML      = "yaml"
+	SourceINI       = "ini"
+	SourceJSON      = "json"
+	SourceScript    = "script"
+	SourceSSH       = "ssh"
+	SourceTerraform = "terraform"
+)
+
+// yamlSource reads a YAML inventory file
+type yamlSource struct {
+	file string
+}
+
+// jsonSource reads a JSON inventory file in the format
+// of the output of dynamic inventory scripts
+type jsonSource struct {
+	file string
+}
+
+// scriptSource executes a dynamic inventory script which prints
+// the inventory in JSON with the --list argument, and the vars of
+// a host with --host if they are not given in _meta.hostvars
+type scriptSource struct {
+	file string
+}
+
+////////// DEFINITION OF ALL FUNCTIONS ///////////////////////////
+
+// NewInventorySource returns the inventory source of the path given.
+//
+// The type of source can be given as a prefix of the path such as
+// "script:./inventory.py". Otherwise, it is detected from the path:
+// terraform state for .tfstate files, JSON for .json files, INI for
+// .ini files, ssh config for files named config or ssh_config, script
+// for executable files. Other files are INI or YAML from their content.
+func NewInventorySource(path string) (InventorySource, error) {
+	kind := ""
+
+	if i := strings.Index(path, ":"); i > 0 {
+		switch path[:i] {
+		case SourceYAML, SourceINI, SourceJSON, SourceScript, SourceSSH, SourceTerraform:
+			kind = path[:i]
+			path = path[i+1:]
+		}
+	}
+
+	path = expandHome(path)
+
+	if kind == "" {
+		kind = detectSource(path)
+	}
+
+	switch kind {
+	case SourceYAML:
+		return &yamlSource{file: path}, nil
+	case SourceINI:
+		return &iniSource{file: path}, nil
+	case SourceJSON:
+		return &jsonSource{file: path}, nil
+	case SourceScript:
+		return &scriptSource{file: path}, nil
+	case SourceSSH:
+		return &sshConfigSource{file: path}, nil
+	case SourceTerraform:
+		return &terraformSource{file: path}, nil
+	}
+
+	return nil, fmt.Errorf("unknown inventory source %s", kind)
+}
+
+// ReadInventorySources reads the inventory sources of the paths given
+// and merges them, in their order, into a new inventory
+func ReadInventorySources(paths []string) *job.Inventory {
+	inventory := job.NewInventory()
+
+	for _, path := range paths {
+		source, err := NewInventorySource(path)
+		if err != nil {
+			log.Fatalw("Invalid inventory source", "inventory", path, "err", err)
+		}
+
+		err = source.Load(inventory)
+		if err != nil {
+			log.Fatalw("Cannot read inventory source", "inventory", path, "err", err)
+		}
+	}
+
+	mergeInventoryVars(inventory)
+
+	return inventory
+}
+
+// Load adds the content of the YAML inventory file
+func (s *yamlSource) Load(inventory *job.Inventory) error {
+	content, err := ioutil.ReadFile(s.file)
+	if err != nil {
+		return err
+	}
+
+	return readYAMLInventory(inventory, decryptContent(content, s.file))
+}
+
+// Load adds the content of the JSON inventory file
+func (s *jsonSource) Load(inventory *job.Inventory) error {
+	content, err := ioutil.ReadFile(s.file)
+	if err != nil {
+		return err
+	}
+
+	return readJSONInventory(inventory, decryptContent(content, s.file), nil)
+}
+
+// Load executes the inventory script and adds its output
+func (s *scriptSource) Load(inventory *job.Inventory) error {
+	content, err := s.exec("--list")
+	if err != nil {
+		return err
+	}
+
+	return readJSONInventory(inventory, content, func(host string) (map[string]interface{}, error) {
+		out, err := s.exec("--host", host)
+		if err != nil {
+			return nil, err
+		}
+
+		vars := make(map[string]interface{})
+
+		err = json.Unmarshal(out, &vars)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vars of host %s: %v", host, err)
+		}
+
+		return vars, nil
+	})
+}
+
+//////////////// INTERNAL FUNCTIONS ////////////////////
+
+// exec executes the script with the arguments and returns its output
+func (s *scriptSource) exec(args ...string) ([]byte, error) {
+	cmd := exec.Command(s.file, args...)
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %v", s.file, strings.Join(args, " "), err)
+	}
+
+	return out, nil
+}
+
+// readJSONInventory adds an inventory in the JSON format of dynamic
+// inventory scripts. Each key is a group with its hosts, children and
+// vars, or only a list of hosts. The group "all" contains the global vars and
+// _meta.hostvars the vars of each host. If _meta is not given, the
+// vars of each host are requested with the function given if any.
+func readJSONInventory(inventory *job.Inventory, content []byte, hostVars func(string) (map[string]interface{}, error)) error {
+	data := make(map[string]interface{})
+
+	err := json.Unmarshal(content, &data)
+	if err != nil {
+		return fmt.Errorf("invalid JSON inventory: %v", err)
+	}
+
+	hosts := make(map[string]map[string]interface{})
+
+	for name, v := range data {
+		if name == "_meta" {
+			continue
+		}
+
+		group := job.Group{Name: name}
+
+		// A group can be only a list of hosts
+		if list, ok := v.([]interface{}); ok {
+			group.Hosts = cast.ToStringSlice(list)
+		} else {
+			g := cast.ToStringMap(v)
+			group.Hosts = cast.ToStringSlice(g["hosts"])
+			group.Children = cast.ToStringSlice(g["children"])
+			group.Vars = decryptVars(cast.ToStringMap(g["vars"]), name)
+		}
+
+		for _, h := range group.Hosts {
+			hosts[h] = nil
+		}
+
+		// Vars of all hosts are the global ones
+		if name == "all" {
+			addGlobalVars(inventory, group.Vars)
+			group.Vars = nil
+		}
+
+		addGroup(inventory, group)
+	}
+
+	meta, hasMeta := data["_meta"]
+	if hasMeta {
+		for h, vars := range cast.ToStringMap(cast.ToStringMap(meta)["hostvars"]) {
+			hosts[h] = decryptVars(cast.ToStringMap(vars), h)
+		}
+	}
+
+	for h, vars := range hosts {
+		if vars == nil && !hasMeta && hostVars != nil {
+			vars, err = hostVars(h)
+			if err != nil {
+				return err
+			}
+		}
+
+		addHost(inventory, job.Host{Name: h, Vars: vars})
+	}
+
+	return nil
+}
+
+// detectSource returns the type of the inventory source of the path
+func detectSource(path string) string {
+	base := filepath.Base(path)
+
+	switch {
+	case strings.HasSuffix(base, ".tfstate"):
+		return SourceTerraform
+	case strings.HasSuffix(base, ".json"):
+		return SourceJSON
+	case strings.HasSuffix(base, ".yml") || strings.HasSuffix(base, ".yaml"):
+		return SourceYAML
+	case strings.HasSuffix(base, ".ini"):
+		return SourceINI
+	case base == "config" || base == "ssh_config":
+		return SourceSSH
+	}
+
+	info, err := os.Stat(path)
+	if err == nil && info.Mode().IsRegular() && info.Mode()&0111 != 0 {
+		return SourceScript
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err == nil && isINIInventory(decryptContent(content, path)) {
+		return SourceINI
+	}
+
+	return SourceYAML
+}
+
+// expandHome replaces the ~ starting a path by the home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home := os.Getenv("HOME")
+	if home == "" {
+		return path
+	}
+
+	return filepath.Join(home, path[1:])
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInventorySources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobflow-sources")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	yml := filepath.Join(dir, "hosts.yml")
+	assert.Nil(t, ioutil.WriteFile(yml, []byte(`
+global:
+  env: dev
+hosts:
+  web1:
+    app_port: 80
+groups:
+  web:
+    hosts: [web1]
+`), 0644))
+
+	jsonFile := filepath.Join(dir, "hosts.json")
+	assert.Nil(t, ioutil.WriteFile(jsonFile, []byte(`{
+  "all": {"vars": {"env": "prod"}},
+  "web": {"hosts": ["web2"], "vars": {"app_port": 8080}},
+  "db": ["db1"],
+  "_meta": {"hostvars": {"web2": {"jobflow_ssh_host": "10.0.0.2"}}}
+}`), 0644))
+
+	script := filepath.Join(dir, "inventory")
+	assert.Nil(t, ioutil.WriteFile(script, []byte(`#!/bin/sh
+if [ "$1" = "--list" ]; then
+  echo '{"cache": ["cache1"]}'
+else
+  echo '{"jobflow_ssh_host": "10.0.0.3", "host": "'$2'"}'
+fi
+`), 0755))
+
+	sshConfig := filepath.Join(dir, "config")
+	assert.Nil(t, ioutil.WriteFile(sshConfig, []byte(`
+# Bastion
+Host bastion jump
+  HostName 192.168.1.1
+  Port 2222
+  User admin
+  IdentityFile ~/.ssh/id_bastion
+
+Host *.internal !skip
+  User ops
+
+Host bastion
+  Port=22
+`), 0644))
+
+	tfstate := filepath.Join(dir, "terraform.tfstate")
+	assert.Nil(t, ioutil.WriteFile(tfstate, []byte(`{
+  "version": 4,
+  "resources": [
+    {"mode": "managed", "type": "aws_instance", "name": "app", "instances": [
+      {"index_key": 0, "attributes": {"id": "i-1", "public_ip": "", "private_ip": "10.1.0.1"}},
+      {"index_key": 1, "attributes": {"id": "i-2", "public_ip": "1.2.3.4", "private_ip": "10.1.0.2"}}
+    ]},
+    {"mode": "managed", "type": "aws_eip", "name": "app", "instances": [
+      {"attributes": {"id": "eip-1", "public_ip": "1.2.3.6"}}
+    ]},
+    {"module": "module.db", "mode": "managed", "type": "aws_instance", "name": "app", "instances": [
+      {"index_key": "primary", "attributes": {"id": "i-4", "private_ip": "10.2.0.1"}}
+    ]},
+    {"mode": "managed", "type": "aws_s3_bucket", "name": "logs", "instances": [
+      {"attributes": {"id": "logs"}}
+    ]},
+    {"mode": "data", "type": "aws_instance", "name": "other", "instances": [
+      {"attributes": {"id": "i-3", "public_ip": "1.2.3.5"}}
+    ]}
+  ]
+}`), 0644))
+
+	// Types detected from the paths
+	for path, kind := range map[string]string{
+		yml:          SourceYAML,
+		jsonFile:     SourceJSON,
+		script:       SourceScript,
+		sshConfig:    SourceSSH,
+		tfstate:      SourceTerraform,
+		"unknown":    SourceYAML,
+		"ssh_config": SourceSSH,
+	} {
+		assert.Equal(t, kind, detectSource(path), path)
+	}
+
+	source, err := NewInventorySource("ssh:" + yml)
+	assert.Nil(t, err)
+	assert.Equal(t, &sshConfigSource{file: yml}, source)
+
+	inv := ReadInventorySources([]string{yml, jsonFile, script, sshConfig, tfstate})
+
+	// Global vars of the last source override the first ones
+	assert.Equal(t, "prod", inv.Global["env"])
+
+	// Groups of several sources are merged
+	assert.Equal(t, []string{"web1", "web2"}, inv.Groups["web"].Hosts)
+	assert.Equal(t, 80, inv.Hosts["web1"].Vars["app_port"])
+	assert.Equal(t, 8080.0, inv.Hosts["web2"].Vars["app_port"])
+	assert.Equal(t, "10.0.0.2", inv.Hosts["web2"].Vars["jobflow_ssh_host"])
+	assert.Equal(t, []string{"db1"}, inv.Groups["db"].Hosts)
+	assert.Equal(t, "prod", inv.Hosts["db1"].Vars["env"])
+
+	// Vars of script hosts are requested with --host without _meta
+	assert.Equal(t, "10.0.0.3", inv.Hosts["cache1"].Vars["jobflow_ssh_host"])
+	assert.Equal(t, "cache1", inv.Hosts["cache1"].Vars["host"])
+
+	// The first value of a host wins in ssh config, wildcards are ignored
+	assert.Equal(t, []string{"bastion", "jump"}, inv.Groups["ssh_config"].Hosts)
+	assert.Equal(t, "192.168.1.1", inv.Hosts["bastion"].Vars["jobflow_ssh_host"])
+	assert.Equal(t, 2222, inv.Hosts["bastion"].Vars["jobflow_ssh_port"])
+	assert.Equal(t, "admin", inv.Hosts["jump"].Vars["jobflow_ssh_user"])
+	assert.Equal(t, filepath.Join(os.Getenv("HOME"), ".ssh/id_bastion"), inv.Hosts["jump"].Vars["jobflow_ssh_privkey"])
+	_, ok := inv.Hosts["skip"]
+	assert.False(t, ok)
+
+	// Terraform instances with an address, named from their full address
+	assert.Equal(t, []string{"aws_instance.app.0", "aws_instance.app.1", "module.db.aws_instance.app.primary"}, inv.Groups["aws_instance"].Hosts)
+	assert.Equal(t, []string{"aws_instance.app.0", "aws_instance.app.1"}, inv.Groups["aws_instance.app"].Hosts)
+	assert.Equal(t, []string{"module.db.aws_instance.app.primary"}, inv.Groups["module.db.aws_instance.app"].Hosts)
+	assert.Equal(t, "10.1.0.1", inv.Hosts["aws_instance.app.0"].Vars["jobflow_ssh_host"])
+	assert.Equal(t, "1.2.3.4", inv.Hosts["aws_instance.app.1"].Vars["jobflow_ssh_host"])
+	assert.Equal(t, "i-2", inv.Hosts["aws_instance.app.1"].Vars["terraform_id"])
+	assert.Equal(t, "aws_instance", inv.Hosts["aws_instance.app.1"].Vars["terraform_type"])
+	assert.Equal(t, "1.2.3.6", inv.Hosts["aws_eip.app"].Vars["jobflow_ssh_host"])
+	assert.Equal(t, "10.2.0.1", inv.Hosts["module.db.aws_instance.app.primary"].Vars["jobflow_ssh_host"])
+	_, ok = inv.Hosts["aws_s3_bucket.logs"]
+	assert.False(t, ok)
+	_, ok = inv.Hosts["aws_instance.other"]
+	assert.False(t, ok)
+
+	hosts, err := inv.MatchHosts("web:&~web[0-9]")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"web1", "web2"}, hosts)
+}
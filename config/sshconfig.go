@@ -0,0 +1,123 @@
+package config
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"github.com/uthng/jobflow/job"
+)
+
+/////////// DECLARATION OF ALL TYPES //////////////////////////
+
+// sshConfigSource reads the hosts of an ssh config file
+// such as ~/.ssh/config. Hosts are added to the group "ssh_config"
+type sshConfigSource struct {
+	file string
+}
+
+////////// DEFINITION OF ALL FUNCTIONS ///////////////////////////
+
+// Load adds the hosts of the ssh config file. Host patterns with
+// wildcards or negations are ignored. HostName, Port, User and
+// IdentityFile set the ssh vars of the hosts
+func (s *sshConfigSource) Load(inventory *job.Inventory) error {
+	f, err := os.Open(s.file)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	group := job.Group{Name: "ssh_config"}
+	hosts := []*job.Host{}
+	byName := make(map[string]*job.Host)
+	current := []*job.Host{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value := splitSSHConfigLine(line)
+
+		switch strings.ToLower(key) {
+		case "host":
+			current = []*job.Host{}
+
+			for _, name := range strings.Fields(value) {
+				if strings.ContainsAny(name, "*?!") {
+					continue
+				}
+
+				h, ok := byName[name]
+				if !ok {
+					h = &job.Host{Name: name, Vars: make(map[string]interface{})}
+					byName[name] = h
+					hosts = append(hosts, h)
+				}
+
+				current = append(current, h)
+			}
+		case "match":
+			// Conditional blocks cannot be resolved statically
+			current = []*job.Host{}
+		case "hostname":
+			setSSHConfigVar(current, "jobflow_ssh_host", value)
+		case "port":
+			setSSHConfigVar(current, "jobflow_ssh_port", cast.ToInt(value))
+		case "user":
+			setSSHConfigVar(current, "jobflow_ssh_user", value)
+		case "identityfile":
+			setSSHConfigVar(current, "jobflow_ssh_privkey", expandHome(value))
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return err
+	}
+
+	for _, h := range hosts {
+		if _, ok := h.Vars["jobflow_ssh_host"]; !ok {
+			h.Vars["jobflow_ssh_host"] = h.Name
+		}
+
+		group.Hosts = appendNames(group.Hosts, h.Name)
+		addHost(inventory, *h)
+	}
+
+	addGroup(inventory, group)
+
+	return nil
+}
+
+//////////////// INTERNAL FUNCTIONS ////////////////////
+
+// splitSSHConfigLine returns the keyword and the value of a line
+// written as "Keyword value" or "Keyword=value"
+func splitSSHConfigLine(line string) (string, string) {
+	i := strings.IndexAny(line, " \t=")
+	if i < 0 {
+		return line, ""
+	}
+
+	value := strings.TrimSpace(line[i:])
+	value = strings.TrimSpace(strings.TrimPrefix(value, "="))
+
+	return line[:i], strings.Trim(value, "\"")
+}
+
+// setSSHConfigVar sets a var of the hosts of the current block.
+// As in ssh, the first value given for a host is kept
+func setSSHConfigVar(hosts []*job.Host, key string, value interface{}) {
+	for _, h := range hosts {
+		if _, ok := h.Vars[key]; !ok {
+			h.Vars[key] = value
+		}
+	}
+}
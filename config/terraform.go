@@ -0,0 +1,108 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/spf13/cast"
+
+	"github.com/uthng/jobflow/job"
+)
+
+/////////// DECLARATION OF ALL TYPES //////////////////////////
+
+// terraformSource reads the hosts of a Terraform state file.
+// Each instance of a managed resource with an IP address is a
+// host added to the groups of its resource type and address
+type terraformSource struct {
+	file string
+}
+
+// tfState is the part of a Terraform state used by the inventory
+type tfState struct {
+	Version   int `json:"version"`
+	Resources []struct {
+		Module    string `json:"module"`
+		Mode      string `json:"mode"`
+		Type      string `json:"type"`
+		Name      string `json:"name"`
+		Instances []struct {
+			IndexKey   interface{}            `json:"index_key"`
+			Attributes map[string]interface{} `json:"attributes"`
+		} `json:"instances"`
+	} `json:"resources"`
+}
+
+// tfAddressAttributes are the attributes giving the address
+// of a resource instance, in the order they are looked for
+var tfAddressAttributes = []string{"public_ip", "ipv4_address", "access_ip_v4", "private_ip", "ip_address"}
+
+////////// DEFINITION OF ALL FUNCTIONS ///////////////////////////
+
+// Load adds the resource instances of the Terraform state having
+// an IP address. A host is named from the full address of its
+// resource, such as module.app.aws_instance.web, suffixed with the
+// index key of the instance if any as in aws_instance.web.0
+func (s *terraformSource) Load(inventory *job.Inventory) error {
+	content, err := ioutil.ReadFile(s.file)
+	if err != nil {
+		return err
+	}
+
+	state := tfState{}
+
+	err = json.Unmarshal(content, &state)
+	if err != nil {
+		return fmt.Errorf("invalid terraform state: %v", err)
+	}
+
+	if state.Version < 4 {
+		return fmt.Errorf("unsupported terraform state version %d", state.Version)
+	}
+
+	for _, r := range state.Resources {
+		if r.Mode != "managed" {
+			continue
+		}
+
+		address := r.Type + "." + r.Name
+		if r.Module != "" {
+			address = r.Module + "." + address
+		}
+
+		for _, inst := range r.Instances {
+			ip := ""
+			for _, attr := range tfAddressAttributes {
+				ip = cast.ToString(inst.Attributes[attr])
+				if ip != "" {
+					break
+				}
+			}
+
+			if ip == "" {
+				continue
+			}
+
+			name := address
+			if inst.IndexKey != nil {
+				name = name + "." + cast.ToString(inst.IndexKey)
+			}
+
+			addHost(inventory, job.Host{
+				Name: name,
+				Vars: map[string]interface{}{
+					"jobflow_ssh_host": ip,
+					"terraform_type":   r.Type,
+					"terraform_id":     cast.ToString(inst.Attributes["id"]),
+				},
+			})
+
+			for _, g := range []string{r.Type, address} {
+				addGroup(inventory, job.Group{Name: g, Hosts: []string{name}})
+			}
+		}
+	}
+
+	return nil
+}
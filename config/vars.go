@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/spf13/cast"
+	"gopkg.in/yaml.v2"
+
+	"github.com/uthng/jobflow/job"
+)
+
+// ReadVarsFile reads the variables of a YAML file given by --vars-file.
+// The file or its values can be encrypted by the vault.
+func ReadVarsFile(file string) (job.VarLayer, error) {
+	layer := job.VarLayer{Source: "vars file " + file}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return layer, err
+	}
+
+	content = decryptContent(content, file)
+
+	vars := make(map[string]interface{})
+
+	err = yaml.Unmarshal(content, &vars)
+	if err != nil {
+		return layer, fmt.Errorf("cannot unmarshal vars file %s: %v", file, err)
+	}
+
+	layer.Vars = decryptVars(cast.ToStringMap(vars), file)
+
+	return layer, nil
+}
+
+// ParseVars parses variables given as key=value by --var.
+// Values are kept as strings
+func ParseVars(args []string) (job.VarLayer, error) {
+	layer := job.VarLayer{Source: "--var", Vars: make(map[string]interface{})}
+
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return layer, fmt.Errorf("invalid variable %s: must be key=value", arg)
+		}
+
+		layer.Vars[strings.TrimSpace(kv[0])] = kv[1]
+	}
+
+	return layer, nil
+}
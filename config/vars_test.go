@@ -0,0 +1,107 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/uthng/jobflow/job"
+)
+
+func TestReadVars(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobflow-vars")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "vars.yml")
+	assert.Nil(t, ioutil.WriteFile(file, []byte("version: 1.0\nhosts: [a, b]\n"), 0644))
+
+	layer, err := ReadVarsFile(file)
+	assert.Nil(t, err)
+	assert.Equal(t, "vars file "+file, layer.Source)
+	assert.Equal(t, 1.0, layer.Vars["version"])
+	assert.Equal(t, []interface{}{"a", "b"}, layer.Vars["hosts"])
+
+	_, err = ReadVarsFile(filepath.Join(dir, "unknown.yml"))
+	assert.NotNil(t, err)
+
+	layer, err = ParseVars([]string{"version=2.0", "cmd=a=b", "empty="})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"version": "2.0", "cmd": "a=b", "empty": ""}, layer.Vars)
+
+	_, err = ParseVars([]string{"version"})
+	assert.NotNil(t, err)
+
+	_, err = ParseVars([]string{"=value"})
+	assert.NotNil(t, err)
+
+	// Task vars, extra vars and host data given to a remote flow
+	jf := job.NewFlow()
+	ReadFlow(jf, []byte(`
+extra_vars:
+  version: "3.0"
+host:
+  name: web1
+  vars:
+    app_port: 8080
+  groups: [web]
+hostvars:
+  web1:
+    app_port: 8080
+
+jobs:
+- name: build
+  tasks:
+  - vars:
+      dir: /src
+    shell:
+      cmd: exec
+      params:
+        cmd: make
+`))
+
+	assert.Equal(t, []job.VarLayer{{Source: "extra vars", Vars: map[string]interface{}{"version": "3.0"}}}, jf.ExtraVars)
+	assert.Equal(t, map[string]interface{}{"dir": "/src"}, jf.Jobs[0].Tasks[0].Vars)
+	assert.Equal(t, "web1", jf.Host["name"])
+	assert.Contains(t, jf.HostVars, "web1")
+}
+
+func TestInventoryVarPrecedence(t *testing.T) {
+	inventory := job.NewInventory()
+	ReadInventory(inventory, []byte(`
+global:
+  jobflow_ssh_user: deploy
+  region: eu
+  tier: global
+
+hosts:
+  host1:
+    tier: host
+
+groups:
+  b:
+    hosts: [host1]
+    vars:
+      region: group-b
+      tier: group-b
+  a:
+    hosts: [host1]
+    vars:
+      region: group-a
+`))
+
+	// Groups are merged in the order of their names
+	// and host vars override all of them
+	assert.Equal(t, map[string]interface{}{
+		"jobflow_ssh_host":    "localhost",
+		"jobflow_ssh_port":    22,
+		"jobflow_ssh_user":    "deploy",
+		"jobflow_ssh_pass":    "",
+		"jobflow_ssh_privkey": "",
+		"region":              "group-b",
+		"tier":                "host",
+	}, inventory.Hosts["host1"].Vars)
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	log "github.com/uthng/golog"
+
+	"github.com/uthng/jobflow/vault"
+)
+
+///////// DECLARATION OF ALL GLOBAL VARIABLES ///////////
+
+// secrets decrypts encrypted files and values
+var secrets *vault.Vault
+
+////////// DEFINITION OF ALL FUNCTIONS ///////////////////////////
+
+// SetVault sets the vault used to decrypt encrypted
+// flow and inventory files and values
+func SetVault(v *vault.Vault) {
+	secrets = v
+}
+
+////////////// INTERNAL FUNCTIONS ////////////////////////
+
+// decryptContent returns the decrypted content of a file
+// if it is encrypted, otherwise the content as it is
+func decryptContent(content []byte, kind string) []byte {
+	if !vault.IsEncrypted(content) {
+		return content
+	}
+
+	if secrets == nil {
+		log.Fatalw("Encrypted file but no vault password is given", "file", kind)
+	}
+
+	plain, err := secrets.Decrypt(content)
+	if err != nil {
+		log.Fatalw("Cannot decrypt file", "file", kind, "err", err)
+	}
+
+	return plain
+}
+
+// decryptVars returns the vars with all their
+// encrypted values decrypted
+func decryptVars(vars map[string]interface{}, kind string) map[string]interface{} {
+	if !vault.HasEncrypted(vars) {
+		return vars
+	}
+
+	if secrets == nil {
+		log.Fatalw("Encrypted values but no vault password is given", "vars", kind)
+	}
+
+	res, err := secrets.DecryptValue(vars)
+	if err != nil {
+		log.Fatalw("Cannot decrypt values", "vars", kind, "err", err)
+	}
+
+	return res.(map[string]interface{})
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/uthng/jobflow/job"
+	"github.com/uthng/jobflow/vault"
+)
+
+func TestReadEncrypted(t *testing.T) {
+	v, err := vault.New([]byte("password"))
+	assert.Nil(t, err)
+
+	SetVault(v)
+	defer SetVault(nil)
+
+	// encrypt returns a YAML block scalar indented by the indent given
+	encrypt := func(str, indent string) string {
+		encrypted, err := v.EncryptString(str)
+		assert.Nil(t, err)
+
+		return "|\n" + indent + strings.Replace(strings.TrimSpace(encrypted), "\n", "\n"+indent, -1)
+	}
+
+	// Inline values in variables
+	flowFile := []byte(`
+variables:
+  user: uthng
+  token: ` + encrypt("github-token", "    ") + `
+
+jobs:
+- name: build
+  tasks:
+  - shell:
+      cmd: exec
+      params:
+        cmd: echo
+`)
+
+	jf := job.NewFlow()
+	ReadFlow(jf, flowFile)
+
+	assert.Equal(t, "uthng", jf.Variables["user"])
+	assert.Equal(t, "github-token", jf.Variables["token"])
+
+	// Whole encrypted file
+	encrypted, err := v.Encrypt(flowFile)
+	assert.Nil(t, err)
+
+	jf = job.NewFlow()
+	ReadFlow(jf, encrypted)
+
+	assert.Equal(t, "github-token", jf.Variables["token"])
+	assert.Equal(t, "build", jf.Jobs[0].Name)
+
+	// Inline values in host and group vars
+	inventoryFile := []byte(`
+hosts:
+  host1:
+    jobflow_ssh_pass: ` + encrypt("passhost1", "      ") + `
+
+groups:
+  group1:
+    hosts:
+    - host1
+    vars:
+      secret: ` + encrypt("group1secret", "        ") + `
+`)
+
+	inventory := job.NewInventory()
+	ReadInventory(inventory, inventoryFile)
+
+	assert.Equal(t, "passhost1", inventory.Hosts["host1"].Vars["jobflow_ssh_pass"])
+	assert.Equal(t, "group1secret", inventory.Groups["group1"].Vars["secret"])
+	assert.Equal(t, "group1secret", inventory.Hosts["host1"].Vars["secret"])
+}
@@ -0,0 +1,159 @@
+package job
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+////////// DEFINITION OF ALL FUNCTIONS ///////////////////////////
+
+// ParseSerial checks and returns a batch size of job serial.
+//
+// The size is a number of hosts or a percentage of the hosts
+// such as "25%". It returns the value and if it is a percentage.
+func ParseSerial(size string) (float64, bool, error) {
+	percent := strings.HasSuffix(size, "%")
+
+	v, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(size, "%")), 64)
+	if err != nil || v <= 0 || (percent && v > 100) || (!percent && v != math.Trunc(v)) {
+		return 0, false, fmt.Errorf("invalid serial size: %s", size)
+	}
+
+	return v, percent, nil
+}
+
+//////////////// INTERNAL FUNCTIONS ////////////////////
+
+// serialBatches splits hosts into batches following the sizes
+// of serial. The last size is repeated until all hosts are in
+// a batch. A batch has at least one host.
+func serialBatches(serial []string, hosts []string) ([][]string, error) {
+	if len(serial) == 0 {
+		return [][]string{hosts}, nil
+	}
+
+	batches := [][]string{}
+	total := len(hosts)
+
+	for i := 0; len(hosts) > 0; i++ {
+		size := serial[len(serial)-1]
+		if i < len(serial) {
+			size = serial[i]
+		}
+
+		v, percent, err := ParseSerial(size)
+		if err != nil {
+			return nil, err
+		}
+
+		count := int(v)
+		if percent {
+			count = int(v * float64(total) / 100)
+		}
+
+		if count < 1 {
+			count = 1
+		}
+
+		if count > len(hosts) {
+			count = len(hosts)
+		}
+
+		batches = append(batches, hosts[:count])
+		hosts = hosts[count:]
+	}
+
+	return batches, nil
+}
+
+// execBatch executes the job on all hosts of a batch in parallel
+// within the limit of forks. It returns the job executed for each host.
+func (f *Flow) execBatch(j *Job, hosts []string, batch int) []*Job {
+	var wg sync.WaitGroup
+
+	jobs := make([]*Job, len(hosts))
+
+	for i, hostname := range hosts {
+		job := copyJob(j)
+		job.Hosts = hostname
+		job.Batch = batch
+
+		f.resumeJob(job, hostname)
+		job.Check = job.Check || f.Check
+
+		jobs[i] = job
+
+		// Job observers receive the events of flow observers too
+		job.observers = append(append([]Observer{}, f.observers...), j.observers...)
+
+		wg.Add(1)
+		go func(job *Job) {
+			defer wg.Done()
+
+			f.acquireFork()
+			defer f.releaseFork()
+
+			start := time.Now()
+			job.notify(&JobStarted{Job: job, Host: job.Hosts, Time: start})
+
+			err := f.execJobViaSSH(job)
+			if err != nil {
+				job.Status = FAILED
+			}
+
+			job.Error = err
+			job.Duration = time.Since(start)
+
+			// Tasks are executed remotely, their events are
+			// sent once their results are received
+			for _, task := range job.AllTasks() {
+				if res, ok := job.Result[task.Name]; ok {
+					job.finishTask(task, res)
+				}
+			}
+
+			job.notify(&JobFinished{
+				Job:      job,
+				Host:     job.Hosts,
+				Time:     time.Now(),
+				Status:   job.Status,
+				Error:    err,
+				Duration: job.Duration,
+			})
+		}(job)
+	}
+
+	wg.Wait()
+
+	return jobs
+}
+
+// acquireFork waits until a host can be executed
+// within the limit of flow forks
+func (f *Flow) acquireFork() {
+	if f.Forks <= 0 {
+		return
+	}
+
+	f.mutex.Lock()
+	if f.forks == nil {
+		f.forks = make(chan struct{}, f.Forks)
+	}
+	forks := f.forks
+	f.mutex.Unlock()
+
+	forks <- struct{}{}
+}
+
+// releaseFork frees the place of a host executed
+func (f *Flow) releaseFork() {
+	if f.Forks <= 0 {
+		return
+	}
+
+	<-f.forks
+}
@@ -0,0 +1,105 @@
+package job
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSerialBatches(t *testing.T) {
+	hosts := []string{"h1", "h2", "h3", "h4", "h5", "h6", "h7", "h8"}
+
+	testCases := []struct {
+		name    string
+		serial  []string
+		batches [][]string
+		err     bool
+	}{
+		{
+			"NoSerial",
+			nil,
+			[][]string{hosts},
+			false,
+		},
+		{
+			"Count",
+			[]string{"3"},
+			[][]string{{"h1", "h2", "h3"}, {"h4", "h5", "h6"}, {"h7", "h8"}},
+			false,
+		},
+		{
+			"Percentage",
+			[]string{"50%"},
+			[][]string{{"h1", "h2", "h3", "h4"}, {"h5", "h6", "h7", "h8"}},
+			false,
+		},
+		{
+			"List",
+			[]string{"1", "2", "50%"},
+			[][]string{{"h1"}, {"h2", "h3"}, {"h4", "h5", "h6", "h7"}, {"h8"}},
+			false,
+		},
+		{
+			"SmallPercentage",
+			[]string{"1%", "100%"},
+			[][]string{{"h1"}, {"h2", "h3", "h4", "h5", "h6", "h7", "h8"}},
+			false,
+		},
+		{
+			"Invalid",
+			[]string{"0"},
+			nil,
+			true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			batches, err := serialBatches(tc.serial, hosts)
+			assert.Equal(t, tc.err, err != nil, "%v", err)
+			assert.Equal(t, tc.batches, batches)
+		})
+	}
+}
+
+func TestParseSerial(t *testing.T) {
+	for _, size := range []string{"1", "10", "25%", "100%"} {
+		_, _, err := ParseSerial(size)
+		assert.Nil(t, err, size)
+	}
+
+	for _, size := range []string{"", "0", "-1", "1.5", "101%", "abc"} {
+		_, _, err := ParseSerial(size)
+		assert.NotNil(t, err, size)
+	}
+}
+
+func TestMaxFailPercentage(t *testing.T) {
+	// Hosts are not declared in the inventory so their execution fails
+	f := NewFlow()
+	f.Inventory = NewInventory()
+	f.Inventory.Groups["web"] = Group{Name: "web", Hosts: []string{"web1", "web2", "web3"}}
+
+	j := NewJob("deploy")
+	j.Hosts = "web"
+	j.Serial = []string{"1"}
+	j.MaxFailPercentage = 0
+	j.AddTask(&Task{Name: "task", Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
+		return NewCmdResult()
+	}}})
+
+	err := f.execJobRemote(j)
+	assert.NotNil(t, err)
+
+	expected := map[string][]int{
+		"web1": {FAILED, 1},
+		"web2": {SKIPPED, 2},
+		"web3": {SKIPPED, 3},
+	}
+
+	assert.Equal(t, len(expected), len(f.Result))
+	for host, r := range f.Result {
+		assert.Equal(t, expected[host], []int{r[0].Status, r[0].Batch})
+	}
+}
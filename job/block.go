@@ -0,0 +1,166 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+//////////////// INTERNAL FUNCTIONS ////////////////////
+
+// isGroup returns true if the task is a group of tasks
+// declared with block, rescue and always
+func (task *Task) isGroup() bool {
+	return len(task.Block) > 0
+}
+
+// runGroup executes the tasks of a group.
+//
+// Block tasks are executed one by one. If one of them fails, the
+// rescue tasks are executed and the group succeeds if they succeed.
+// Always tasks are all executed in any case and the group fails
+// if one of them fails. Block and rescue tasks succeeded in the
+// previous run are restored if resume is set.
+func (job *Job) runGroup(ctx context.Context, task *Task, resume bool) *CmdResult {
+	res := NewCmdResult()
+	res.Status = SUCCESS
+
+	err := job.runTaskList(ctx, task.Block, false, resume)
+	if err != nil && len(task.Rescue) > 0 {
+		log.Warnw("Task block failed, rescuing", "task", task.Name, "err", err)
+
+		res.Result["rescued"] = true
+		err = job.runTaskList(ctx, task.Rescue, false, resume)
+	}
+
+	if len(task.Always) > 0 {
+		// Always tasks are executed even if the job timed out
+		alwaysErr := job.runTaskList(context.Background(), task.Always, true, false)
+		if err == nil {
+			err = alwaysErr
+		}
+	}
+
+	if err != nil {
+		res.Status = FAILED
+		res.Error = err
+	}
+
+	return res
+}
+
+// runAlways executes the always tasks of the job whatever the
+// result of the main tasks. Job timeout does not apply to them
+// and they are executed again when the job is resumed.
+func (job *Job) runAlways() error {
+	if len(job.Always) == 0 {
+		return nil
+	}
+
+	log.Infow("Job running always tasks", "job", job.Name)
+
+	err := job.runTaskList(context.Background(), job.Always, true, false)
+	if err != nil {
+		log.Errorw("Job always tasks failed", "job", job.Name, "err", err)
+	}
+
+	return err
+}
+
+// runTaskList executes a list of tasks one by one in their order.
+// OnSuccess and OnFailure are ignored.
+//
+// It stops at the first task failed and returns its error, unless
+// keepGoing is set. In this case, all tasks are executed and
+// the error contains the names of the tasks failed. Tasks succeeded
+// in the previous run are restored only if resume is set.
+func (job *Job) runTaskList(ctx context.Context, tasks []*Task, keepGoing, resume bool) error {
+	errs := []string{}
+
+	for _, task := range tasks {
+		log.Infow("Task running", "task", task.Name)
+
+		if ctx.Err() != nil {
+			err := job.timeoutError(task.Name)
+			log.Errorw("Task not started", "task", task.Name, "err", err)
+			return err
+		}
+
+		if task.Cmd.Func == nil && !task.isGroup() {
+			log.Warnw("Task ignored", "task", task.Name, "reason", "func is nil")
+			continue
+		}
+
+		res, err := job.execTask(ctx, task, resume)
+		if err == nil {
+			err = res.Error
+		}
+
+		if err != nil {
+			if !keepGoing {
+				return err
+			}
+
+			errs = append(errs, task.Name)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d task(s) failed: %s", len(errs), strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+// checkNestedTasks checks that names of tasks declared in groups
+// and in job always tasks are unique in the job
+func (job *Job) checkNestedTasks() error {
+	names := make(map[string]bool)
+	for _, task := range job.Tasks {
+		names[task.Name] = true
+	}
+
+	var check func(tasks []*Task) error
+	check = func(tasks []*Task) error {
+		for _, task := range tasks {
+			if names[task.Name] {
+				return fmt.Errorf("task %s is declared several times", task.Name)
+			}
+
+			names[task.Name] = true
+
+			err := checkGroup(task, check)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for _, task := range job.Tasks {
+		err := checkGroup(task, check)
+		if err != nil {
+			return err
+		}
+	}
+
+	return check(job.Always)
+}
+
+// checkGroup checks the task lists of a group with
+// the given function
+func checkGroup(task *Task, check func([]*Task) error) error {
+	if !task.isGroup() && (len(task.Rescue) > 0 || len(task.Always) > 0) {
+		return fmt.Errorf("task %s: rescue and always require a block", task.Name)
+	}
+
+	for _, tasks := range [][]*Task{task.Block, task.Rescue, task.Always} {
+		err := check(tasks)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
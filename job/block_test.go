@@ -0,0 +1,127 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newListTask(name string, executed *[]string, fail bool) *Task {
+	return &Task{
+		Name: name,
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
+			*executed = append(*executed, name)
+			if fail {
+				return &CmdResult{Error: errors.New("NOK"), Result: map[string]interface{}{}}
+			}
+			return &CmdResult{Error: nil, Result: map[string]interface{}{}}
+		}},
+	}
+}
+
+func TestTaskGroup(t *testing.T) {
+	testCases := []struct {
+		name       string
+		blockFail  bool
+		rescueFail bool
+		alwaysFail bool
+		hasRescue  bool
+		executed   []string
+		err        bool
+		rescued    bool
+	}{
+		{"BlockSucceeded", false, false, false, true, []string{"b1", "b2", "a1", "a2", "next"}, false, false},
+		{"Rescued", true, false, false, true, []string{"b1", "r1", "a1", "a2", "next"}, false, true},
+		{"RescueFailed", true, true, false, true, []string{"b1", "r1", "a1", "a2"}, true, true},
+		{"NoRescue", true, false, false, false, []string{"b1", "a1", "a2"}, true, false},
+		{"AlwaysFailed", false, false, true, true, []string{"b1", "b2", "a1", "a2"}, true, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			executed := []string{}
+
+			group := &Task{
+				Name: "group",
+				Block: []*Task{
+					newListTask("b1", &executed, tc.blockFail),
+					newListTask("b2", &executed, false),
+				},
+				Always: []*Task{
+					newListTask("a1", &executed, tc.alwaysFail),
+					newListTask("a2", &executed, false),
+				},
+				OnSuccess: "next",
+			}
+			if tc.hasRescue {
+				group.Rescue = []*Task{newListTask("r1", &executed, tc.rescueFail)}
+			}
+
+			w := NewJob("Job Group")
+			w.Start = group
+			w.AddTask(group)
+			w.AddTask(newListTask("next", &executed, false))
+
+			err := w.Run("")
+			assert.Equal(t, tc.err, err != nil, "%v", err)
+			assert.Equal(t, tc.executed, executed)
+			assert.Equal(t, tc.rescued, w.Result["group"].Result["rescued"] == true)
+		})
+	}
+}
+
+func TestJobAlways(t *testing.T) {
+	executed := []string{}
+
+	slow := &Task{
+		Name: "slow",
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
+			<-ctx.Done()
+			return &CmdResult{Error: ctx.Err(), Result: map[string]interface{}{}}
+		}},
+	}
+
+	w := NewJob("Job Always")
+	w.Timeout = 50 * time.Millisecond
+	w.Start = slow
+	w.AddTask(slow)
+	w.Always = []*Task{
+		newListTask("cleanup1", &executed, true),
+		newListTask("cleanup2", &executed, false),
+	}
+
+	err := w.Run("")
+	assert.True(t, IsTimeout(err), "%v", err)
+	assert.Equal(t, FAILED, w.Status)
+	assert.Equal(t, []string{"cleanup1", "cleanup2"}, executed)
+	assert.NotNil(t, w.CleanupErr)
+
+	// Cleanup failures do not change the job status
+	executed = []string{}
+	w = NewJob("Job Always")
+	w.Start = newListTask("ok", &executed, false)
+	w.AddTask(w.Start)
+	w.Always = []*Task{newListTask("cleanup", &executed, true)}
+
+	err = w.Run("")
+	assert.Nil(t, err)
+	assert.Equal(t, SUCCESS, w.Status)
+	assert.Equal(t, []string{"ok", "cleanup"}, executed)
+	assert.NotNil(t, w.CleanupErr)
+}
+
+func TestCheckNestedTasks(t *testing.T) {
+	executed := []string{}
+
+	w := NewJob("Job Group")
+	w.AddTask(newListTask("t1", &executed, false))
+	w.AddTask(&Task{Name: "group", Block: []*Task{newListTask("t1", &executed, false)}})
+	assert.NotNil(t, w.CheckTasks())
+
+	w = NewJob("Job Group")
+	w.AddTask(&Task{Name: "rescue", Rescue: []*Task{newListTask("t1", &executed, false)}})
+	assert.NotNil(t, w.CheckTasks())
+}
@@ -0,0 +1,48 @@
+package job
+
+import (
+	"context"
+	"fmt"
+)
+
+/////////// DECLARATION OF ALL TYPES //////////////////////////
+
+// checkModeKey is the context key of check mode
+type checkModeKey struct{}
+
+////////// DEFINITION OF ALL FUNCTIONS ///////////////////////////
+
+// IsCheckMode returns true if the command executed with the context
+// must only report the actions it would perform, without doing them
+func IsCheckMode(ctx context.Context) bool {
+	check, _ := ctx.Value(checkModeKey{}).(bool)
+	return check
+}
+
+// Plan adds an action that the command would perform
+// to the planned actions of the result
+func (c *CmdResult) Plan(format string, args ...interface{}) {
+	c.Planned = append(c.Planned, fmt.Sprintf(format, args...))
+}
+
+//////////////// INTERNAL FUNCTIONS ////////////////////
+
+// printPlanned sends the actions planned by the task
+// to the job output and logs them
+func (job *Job) printPlanned(task *Task, res *CmdResult) {
+	for _, action := range res.Planned {
+		action = MaskSecrets(action)
+
+		log.Infow("Task planned", "task", task.Name, "hosts", job.Hosts, "action", action)
+
+		if job.OnOutput != nil {
+			job.OnOutput(OutputLine{
+				Job:    job.Name,
+				Task:   task.Name,
+				Host:   job.Hosts,
+				Stream: StreamPlanned,
+				Line:   action,
+			})
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package job
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckMode(t *testing.T) {
+	var mutex sync.Mutex
+	lines := []OutputLine{}
+	executed := false
+
+	plan := func(ctx context.Context, m map[string]interface{}) *CmdResult {
+		res := NewCmdResult()
+		if IsCheckMode(ctx) {
+			res.Plan("create release %s", m["version"])
+			return res
+		}
+
+		res.Result["created"] = m["version"]
+		return res
+	}
+
+	exec := func(ctx context.Context, m map[string]interface{}) *CmdResult {
+		executed = true
+		return NewCmdResult()
+	}
+
+	build := &Task{Name: "build", Cmd: Cmd{Func: exec}, OnSuccess: "release"}
+	release := &Task{
+		Name:   "release",
+		Cmd:    Cmd{Func: plan, SupportsCheck: true},
+		Params: map[string]interface{}{"version": "1.0"},
+		Loop:   []interface{}{"a", "b"},
+	}
+
+	j := NewJob("job1")
+	j.AddTask(build)
+	j.AddTask(release)
+
+	f := NewFlow()
+	f.Check = true
+	f.Jobs = []*Job{j}
+	f.OnOutput = func(l OutputLine) {
+		mutex.Lock()
+		lines = append(lines, l)
+		mutex.Unlock()
+	}
+
+	err := f.RunAllJobs()
+	assert.Nil(t, err)
+	assert.False(t, executed)
+
+	w := f.Result["localhost"][0]
+	assert.Equal(t, SKIPPED, w.Result["build"].Status)
+	assert.Equal(t, "check mode not supported by command", w.Result["build"].Result["skip_reason"])
+
+	assert.Equal(t, SUCCESS, w.Result["release"].Status)
+	assert.Equal(t, []string{"create release 1.0", "create release 1.0"}, w.Result["release"].Planned)
+
+	assert.Equal(t, 2, len(lines))
+	assert.Equal(t, OutputLine{Job: "job1", Task: "release", Stream: StreamPlanned, Line: "create release 1.0"}, lines[0])
+
+	// Commands are executed normally out of check mode
+	assert.False(t, IsCheckMode(context.Background()))
+}
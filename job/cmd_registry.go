@@ -1,9 +1,10 @@
 package job
 
 import (
-	//    "fmt"
-
-	log "github.com/uthng/golog"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
 )
 
 /////// DECLARATION OF ALL TYPES /////////////
@@ -14,10 +15,54 @@ type CmdResult struct {
 	Error error
 	// Result is a map containing output of each task
 	Result map[string]interface{}
+	// Attempts is the number of times the command was executed
+	Attempts int
+	// AttemptResults is the status, error and duration of each attempt
+	AttemptResults []Attempt
+	// Status is the status of the task: SUCCESS, FAILED or SKIPPED
+	Status int
+	// Facts are values added by the command to the job context
+	// and available in templates as .context.facts
+	Facts map[string]interface{}
+	// Duration is the time taken by the task including retries
+	Duration time.Duration
+	// Planned is the list of actions the command would perform.
+	// It is set by commands executed in check mode
+	Planned []string
+}
+
+// Attempt is the result of one execution of a task command
+type Attempt struct {
+	Status   int
+	Error    error
+	Duration time.Duration
+}
+
+// attemptJSON is the JSON representation of an attempt
+type attemptJSON struct {
+	Status   int
+	Error    string `json:",omitempty"`
+	Duration time.Duration
+}
+
+// cmdResultJSON is the JSON representation of a command result
+// in which the error is kept as a string
+type cmdResultJSON struct {
+	Error          string
+	Result         map[string]interface{}
+	Attempts       int
+	AttemptResults []attemptJSON `json:",omitempty"`
+	Status         int
+	Facts          map[string]interface{} `json:",omitempty"`
+	Duration       time.Duration
+	Planned        []string `json:",omitempty"`
 }
 
-// CmdFunc is a command function
-type CmdFunc func(map[string]interface{}) *CmdResult
+// CmdFunc is a command function.
+//
+// The context given is cancelled when the task or the job
+// times out, so commands must stop as soon as it is done.
+type CmdFunc func(context.Context, map[string]interface{}) *CmdResult
 
 // Plugin contains les informations of a module
 type Plugin struct {
@@ -37,6 +82,13 @@ type Cmd struct {
 	Func CmdFunc
 	// Plugin is the module to which the command belongs to
 	Plugin Plugin
+	// Params is the specification of the command params.
+	// Params are not checked if it is empty
+	Params []Param
+	// SupportsCheck indicates that the command only reports the
+	// actions it would perform when it is executed in check mode.
+	// Otherwise, it is skipped in check mode
+	SupportsCheck bool
 }
 
 // CmdRegistry is a registry for commands
@@ -73,6 +125,73 @@ func NewCmdResult() *CmdResult {
 	return c
 }
 
+// MarshalJSON converts the command result into JSON.
+// The error is converted to its message.
+func (c *CmdResult) MarshalJSON() ([]byte, error) {
+	r := cmdResultJSON{
+		Result:   normalizeMap(c.Result),
+		Attempts: c.Attempts,
+		Status:   c.Status,
+		Facts:    normalizeMap(c.Facts),
+		Duration: c.Duration,
+		Planned:  c.Planned,
+	}
+
+	if c.Error != nil {
+		r.Error = c.Error.Error()
+	}
+
+	for _, a := range c.AttemptResults {
+		aj := attemptJSON{Status: a.Status, Duration: a.Duration}
+		if a.Error != nil {
+			aj.Error = a.Error.Error()
+		}
+
+		r.AttemptResults = append(r.AttemptResults, aj)
+	}
+
+	return json.Marshal(r)
+}
+
+// UnmarshalJSON reads a command result converted by MarshalJSON
+func (c *CmdResult) UnmarshalJSON(data []byte) error {
+	r := cmdResultJSON{}
+
+	err := json.Unmarshal(data, &r)
+	if err != nil {
+		return err
+	}
+
+	c.Error = nil
+	if r.Error != "" {
+		c.Error = errors.New(r.Error)
+	}
+
+	c.Result = r.Result
+	if c.Result == nil {
+		c.Result = make(map[string]interface{})
+	}
+
+	c.Attempts = r.Attempts
+	c.Status = r.Status
+
+	c.AttemptResults = nil
+	for _, aj := range r.AttemptResults {
+		a := Attempt{Status: aj.Status, Duration: aj.Duration}
+		if aj.Error != "" {
+			a.Error = errors.New(aj.Error)
+		}
+
+		c.AttemptResults = append(c.AttemptResults, a)
+	}
+
+	c.Facts = r.Facts
+	c.Duration = r.Duration
+	c.Planned = r.Planned
+
+	return nil
+}
+
 // GetCmdRegistry returns the command registry initialized
 func GetCmdRegistry() *CmdRegistry {
 	return cmdRegistry
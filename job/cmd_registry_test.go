@@ -1,6 +1,7 @@
 package job_test
 
 import (
+	"context"
 	//"fmt"
 	"testing"
 
@@ -8,13 +9,13 @@ import (
 	"github.com/uthng/jobflow/job"
 )
 
-var module = job.Module{
+var plugin = job.Plugin{
 	Name:        "ModTest",
 	Version:     "0.1",
 	Description: "ModTest",
 }
 
-var fn = func(map[string]interface{}) *job.CmdResult {
+var fn = func(context.Context, map[string]interface{}) *job.CmdResult {
 	log.Debugln("CmdFunc test")
 	return &job.CmdResult{Error: nil, Result: nil}
 }
@@ -23,17 +24,17 @@ var cmds = []job.Cmd{
 	{
 		Name:   "cmd1",
 		Func:   fn,
-		Module: module,
+		Plugin: plugin,
 	},
 	{
 		Name:   "cmd2",
 		Func:   fn,
-		Module: module,
+		Plugin: plugin,
 	},
 	{
 		Name:   "cmd3",
 		Func:   fn,
-		Module: module,
+		Plugin: plugin,
 	},
 }
 
@@ -84,7 +85,7 @@ func TestCmdUnregister(t *testing.T) {
 func TestGetCmdByName(t *testing.T) {
 	cmd, ok := job.GetCmdByName("ModTest.cmd3")
 	if ok {
-		cmd.Func(nil)
+		cmd.Func(context.Background(), nil)
 	} else {
 		t.Fail()
 	}
@@ -0,0 +1,241 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+////////// DEFINITION OF ALL FUNCTIONS ///////////////////////////
+
+// RunDAG executes all tasks following their dependencies.
+//
+// A task is started as soon as all tasks it depends on succeeded
+// or were skipped by their when condition, so independent tasks
+// are executed concurrently within the limit of MaxParallel.
+//
+// If a task fails, the tasks depending on it directly or not are
+// skipped, the others keep going unless FailFast is set. In this
+// case, running tasks are cancelled and no new task is started.
+//
+// It returns an error if at least one task failed.
+func (job *Job) RunDAG(ctx context.Context) error {
+	type done struct {
+		task *Task
+		err  error
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pending := make(map[string]bool)
+	finished := make(map[string]bool)
+	// failed contains failed tasks and tasks skipped because of them
+	failed := make(map[string]bool)
+	errs := []string{}
+	stop := false
+	running := 0
+
+	ch := make(chan done)
+
+	for _, task := range job.Tasks {
+		pending[task.Name] = true
+	}
+
+	for {
+		// Loop until no task can be started or skipped anymore.
+		// Skipping a task may unblock the tasks declared before it
+		progress := true
+		for progress {
+			progress = false
+
+			for _, task := range job.Tasks {
+				if !pending[task.Name] {
+					continue
+				}
+
+				ready, blocked := job.checkTaskReady(task, finished, failed)
+				if !ready && !stop {
+					continue
+				}
+
+				if blocked || stop {
+					reason := "dependency failed"
+					if stop {
+						reason = "fail fast"
+					}
+
+					job.skipTask(task, reason)
+					delete(pending, task.Name)
+					finished[task.Name] = true
+					failed[task.Name] = true
+					progress = true
+					continue
+				}
+
+				if job.MaxParallel > 0 && running >= job.MaxParallel {
+					continue
+				}
+
+				delete(pending, task.Name)
+				running++
+
+				go func(t *Task) {
+					ch <- done{task: t, err: job.runDAGTask(ctx, t)}
+				}(task)
+			}
+		}
+
+		if running == 0 {
+			break
+		}
+
+		// Wait for a task to finish
+		d := <-ch
+		running--
+		finished[d.task.Name] = true
+
+		if d.err != nil {
+			failed[d.task.Name] = true
+			errs = append(errs, d.task.Name)
+
+			if job.FailFast && !stop {
+				log.Warnw("Stopping all tasks", "job", job.Name, "task", d.task.Name, "reason", "fail fast")
+				stop = true
+				cancel()
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d task(s) failed: %s", len(errs), strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+//////////////// INTERNAL FUNCTIONS ////////////////////
+
+// hasDependencies returns true if at least one task of
+// the job declares dependencies
+func (job *Job) hasDependencies() bool {
+	for _, task := range job.Tasks {
+		if len(task.DependsOn) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkDependencyCycles returns an error if task dependencies
+// contain a cycle
+func (job *Job) checkDependencyCycles() error {
+	const (
+		visiting = iota + 1
+		visited
+	)
+
+	state := make(map[string]int)
+
+	var visit func(task *Task, path []string) error
+	visit = func(task *Task, path []string) error {
+		path = append(path, task.Name)
+
+		switch state[task.Name] {
+		case visiting:
+			return fmt.Errorf("task dependency cycle: %s", strings.Join(path, " -> "))
+		case visited:
+			return nil
+		}
+
+		state[task.Name] = visiting
+
+		for _, dep := range task.DependsOn {
+			t, err := job.GetTaskByName(dep)
+			if err != nil {
+				return err
+			}
+
+			err = visit(t, path)
+			if err != nil {
+				return err
+			}
+		}
+
+		state[task.Name] = visited
+
+		return nil
+	}
+
+	for _, task := range job.Tasks {
+		err := visit(task, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkTaskReady returns if all dependencies of the task are finished
+// and if one of them failed
+func (job *Job) checkTaskReady(task *Task, finished, failed map[string]bool) (bool, bool) {
+	ready := true
+	blocked := false
+
+	for _, dep := range task.DependsOn {
+		if !finished[dep] {
+			ready = false
+		}
+
+		if failed[dep] {
+			blocked = true
+		}
+	}
+
+	return ready, blocked
+}
+
+// runDAGTask executes a task of the graph and returns
+// an error if it failed
+func (job *Job) runDAGTask(ctx context.Context, task *Task) error {
+	log.Infow("Task running", "task", task.Name)
+
+	if ctx.Err() != nil {
+		err := ctx.Err()
+		if err == context.DeadlineExceeded {
+			err = job.timeoutError(task.Name)
+		}
+
+		log.Errorw("Task not started", "task", task.Name, "err", err)
+		job.failTask(task, err, time.Time{})
+		return err
+	}
+
+	if task.Cmd.Func == nil && !task.isGroup() {
+		log.Warnw("Task ignored", "task", task.Name, "reason", "func is nil")
+		return nil
+	}
+
+	res, err := job.execTask(ctx, task, true)
+	if err != nil {
+		return err
+	}
+
+	return res.Error
+}
+
+// skipTask records the task as skipped in the job result
+func (job *Job) skipTask(task *Task, reason string) *CmdResult {
+	log.Infow("Task skipped", "task", task.Name, "reason", reason)
+
+	res := NewCmdResult()
+	res.Status = SKIPPED
+	res.Result["skip_reason"] = reason
+	job.setResult(task.Name, res)
+	job.finishTask(task, res)
+
+	return res
+}
@@ -0,0 +1,156 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newDAGTask(name string, deps []string, fn CmdFunc) *Task {
+	return &Task{
+		Name:      name,
+		Cmd:       Cmd{Func: fn},
+		DependsOn: deps,
+	}
+}
+
+func TestCheckTasksDependencies(t *testing.T) {
+	fn := func(ctx context.Context, m map[string]interface{}) *CmdResult {
+		return &CmdResult{Error: nil, Result: nil}
+	}
+
+	testCases := []struct {
+		name  string
+		tasks []*Task
+		err   bool
+	}{
+		{
+			"Valid",
+			[]*Task{
+				newDAGTask("a", nil, fn),
+				newDAGTask("b", []string{"a"}, fn),
+				newDAGTask("c", []string{"a", "b"}, fn),
+			},
+			false,
+		},
+		{
+			"UnknownTask",
+			[]*Task{
+				newDAGTask("a", nil, fn),
+				newDAGTask("b", []string{"x"}, fn),
+			},
+			true,
+		},
+		{
+			"OnFailure",
+			[]*Task{
+				{Name: "a", Cmd: Cmd{Func: fn}, OnFailure: "c"},
+				newDAGTask("b", []string{"a"}, fn),
+				newDAGTask("c", nil, fn),
+			},
+			true,
+		},
+		{
+			"Cycle",
+			[]*Task{
+				newDAGTask("a", []string{"c"}, fn),
+				newDAGTask("b", []string{"a"}, fn),
+				newDAGTask("c", []string{"b"}, fn),
+			},
+			true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := NewJob("Job DAG")
+			for _, task := range tc.tasks {
+				w.AddTask(task)
+			}
+
+			err := w.CheckTasks()
+			assert.Equal(t, tc.err, err != nil, "%v", err)
+		})
+	}
+}
+
+func TestRunDAG(t *testing.T) {
+	var mutex sync.Mutex
+	var running, maxRunning int
+
+	ok := func(ctx context.Context, m map[string]interface{}) *CmdResult {
+		mutex.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mutex.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+
+		return &CmdResult{Error: nil, Result: map[string]interface{}{}}
+	}
+
+	nok := func(ctx context.Context, m map[string]interface{}) *CmdResult {
+		return &CmdResult{Error: errors.New("NOK"), Result: map[string]interface{}{}}
+	}
+
+	w := NewJob("Job DAG")
+	w.MaxParallel = 2
+	w.AddTask(newDAGTask("build1", nil, ok))
+	w.AddTask(newDAGTask("build2", nil, ok))
+	w.AddTask(newDAGTask("build3", nil, nok))
+	w.AddTask(newDAGTask("upload1", []string{"build1", "build2"}, ok))
+	w.AddTask(newDAGTask("upload3", []string{"build3"}, ok))
+	w.AddTask(newDAGTask("release", []string{"upload1", "upload3"}, ok))
+
+	err := w.Run("")
+	assert.NotNil(t, err)
+	assert.Equal(t, FAILED, w.Status)
+	assert.Equal(t, 2, maxRunning)
+
+	assert.Equal(t, SUCCESS, w.Result["build1"].Status)
+	assert.Equal(t, SUCCESS, w.Result["build2"].Status)
+	assert.Equal(t, FAILED, w.Result["build3"].Status)
+	assert.Equal(t, SUCCESS, w.Result["upload1"].Status)
+	assert.Equal(t, SKIPPED, w.Result["upload3"].Status)
+	assert.Equal(t, SKIPPED, w.Result["release"].Status)
+}
+
+func TestRunDAGFailFast(t *testing.T) {
+	slow := func(ctx context.Context, m map[string]interface{}) *CmdResult {
+		select {
+		case <-ctx.Done():
+			return &CmdResult{Error: ctx.Err(), Result: map[string]interface{}{}}
+		case <-time.After(time.Second):
+			return &CmdResult{Error: nil, Result: map[string]interface{}{}}
+		}
+	}
+
+	nok := func(ctx context.Context, m map[string]interface{}) *CmdResult {
+		return &CmdResult{Error: errors.New("NOK"), Result: map[string]interface{}{}}
+	}
+
+	w := NewJob("Job DAG")
+	w.FailFast = true
+	w.AddTask(newDAGTask("slow", nil, slow))
+	w.AddTask(newDAGTask("fail", nil, nok))
+	w.AddTask(newDAGTask("after-slow", []string{"slow"}, slow))
+
+	start := time.Now()
+	err := w.Run("")
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+
+	assert.Equal(t, FAILED, w.Result["slow"].Status)
+	assert.Equal(t, FAILED, w.Result["fail"].Status)
+	assert.Equal(t, SKIPPED, w.Result["after-slow"].Status)
+}
@@ -1,19 +1,23 @@
 package job
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"gopkg.in/yaml.v2"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 	//"time"
 
 	"github.com/spf13/cast"
 
 	"github.com/uthng/gossh"
-
-	log "github.com/uthng/golog"
 )
 
 /////// DECLARATION OF ALL TYPES /////////////////////////
@@ -32,8 +36,64 @@ type Flow struct {
 	// even if it is local
 	IsOnRemote bool
 
+	// Limit is a host pattern restricting the hosts
+	// of remote jobs. No restriction if it is empty
+	Limit string
+
+	// Forks is the maximum number of hosts on which jobs are
+	// executed at the same time in the flow. No limit if it is 0
+	Forks int
+
+	// OnOutput receives the output lines of task commands
+	// of all jobs, including the ones of remote hosts
+	OnOutput OutputFunc
+
+	// Secrets are the names of the variables whose values are
+	// secret. SecretPatterns are the patterns of param names whose
+	// values are secret. Secrets are masked in logs and outputs
+	Secrets        []string
+	SecretPatterns []string
+
+	// Host and HostVars are the data of the host executing the flow
+	// and the vars of all hosts, given to a remote flow by the local
+	// one. They replace the ones of the inventory if they are not nil
+	Host     map[string]interface{}
+	HostVars map[string]interface{}
+
+	// ExtraVars are the variables of vars files and of the command
+	// line. They override all other variables, including task vars
+	ExtraVars []VarLayer
+
+	// Check executes the flow in check mode: commands report the
+	// actions they would perform and those not supporting it are skipped
+	Check bool
+
+	// Hash is the hash of the flow file content
+	Hash string
+	// Resume is the state of a previous run of the flow. Tasks
+	// succeeded in it are not executed again
+	Resume *State
+
 	Status int
 	Result map[string][]*Job
+	// Duration is the time taken by the last run of the flow
+	Duration time.Duration
+
+	// mutex protects Result when jobs are executed in parallel
+	mutex sync.Mutex
+	// forks is the semaphore limiting hosts executed in parallel
+	forks chan struct{}
+	// observers receive the events of the flow and its jobs
+	observers []Observer
+}
+
+// remoteJobResult is the job result printed by a remote
+// execution and read back by the local flow
+type remoteJobResult struct {
+	Status       int
+	Result       map[string]*CmdResult
+	Facts        map[string]interface{} `json:",omitempty"`
+	CleanupError string                 `json:",omitempty"`
 }
 
 ////////// DEFINITION OF ALL FUNCTIONS ///////////////////////////
@@ -43,6 +103,7 @@ func NewFlow() *Flow {
 	flow := &Flow{
 		Variables:     make(map[string]interface{}),
 		RemoteExecDir: "$HOME",
+		OnOutput:      PrintOutput,
 		Status:        SUCCESS,
 		Result:        make(map[string][]*Job),
 	}
@@ -50,17 +111,218 @@ func NewFlow() *Flow {
 	return flow
 }
 
-// RunAllJobs executes all jobs
-func (f *Flow) RunAllJobs() {
-	// Loop jobs and exec job by job.
-	for _, j := range f.Jobs {
-		log.Infoln("Executing job", j.Name)
-		f.execJob(j)
+// RunAllJobs executes all jobs following their needs.
+//
+// A job is started as soon as all jobs it needs succeeded, so
+// independent jobs are executed in parallel. Jobs needing a failed
+// job, directly or not, are skipped. The flow status is FAILED if
+// at least one job failed or was skipped.
+//
+// It returns an error if at least one job failed.
+func (f *Flow) RunAllJobs() error {
+	start := time.Now()
+	f.notify(&FlowStarted{Flow: f, Time: start})
+
+	err := f.registerSecrets()
+	if err == nil {
+		err = f.runAllJobs()
 	}
+
+	f.finish(err, start)
+
+	return err
 }
 
 // RunJob executes a specified job with the name given
 func (f *Flow) RunJob(job string) error {
+	start := time.Now()
+	f.notify(&FlowStarted{Flow: f, Time: start})
+
+	err := f.registerSecrets()
+	if err == nil {
+		err = f.runJob(job)
+	}
+
+	f.finish(err, start)
+
+	return err
+}
+
+// CheckJobs checks that job names are unique and that jobs
+// needed by a job exist without any cycle
+func (f *Flow) CheckJobs() error {
+	jobs := make(map[string]*Job)
+
+	for _, j := range f.Jobs {
+		if _, ok := jobs[j.Name]; ok {
+			return fmt.Errorf("job %s is declared several times", j.Name)
+		}
+
+		jobs[j.Name] = j
+	}
+
+	for _, j := range f.Jobs {
+		for _, need := range j.Needs {
+			if _, ok := jobs[need]; !ok {
+				return fmt.Errorf("job %s needed by %s does not exist", need, j.Name)
+			}
+		}
+	}
+
+	// Needs must not contain any cycle
+	const (
+		visiting = iota + 1
+		visited
+	)
+
+	state := make(map[string]int)
+
+	var visit func(j *Job, path []string) error
+	visit = func(j *Job, path []string) error {
+		path = append(path, j.Name)
+
+		switch state[j.Name] {
+		case visiting:
+			return fmt.Errorf("job needs cycle: %s", strings.Join(path, " -> "))
+		case visited:
+			return nil
+		}
+
+		state[j.Name] = visiting
+
+		for _, need := range j.Needs {
+			err := visit(jobs[need], path)
+			if err != nil {
+				return err
+			}
+		}
+
+		state[j.Name] = visited
+
+		return nil
+	}
+
+	for _, j := range f.Jobs {
+		err := visit(j, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/////////// INTERNAL FUNCTIONS /////////////////////////:
+
+// finish sends the event of the flow finished
+func (f *Flow) finish(err error, start time.Time) {
+	f.Duration = time.Since(start)
+
+	f.notify(&FlowFinished{
+		Flow:     f,
+		Time:     time.Now(),
+		Status:   f.Status,
+		Error:    err,
+		Duration: f.Duration,
+	})
+}
+
+// runAllJobs executes all jobs following their needs
+func (f *Flow) runAllJobs() error {
+	type done struct {
+		job *Job
+		err error
+	}
+
+	err := f.CheckJobs()
+	if err == nil {
+		err = f.CheckHosts()
+	}
+
+	if err != nil {
+		f.Status = FAILED
+		log.Errorw(err.Error())
+		return err
+	}
+
+	pending := make(map[string]bool)
+	finished := make(map[string]bool)
+	// failed contains failed jobs and jobs skipped because of them
+	failed := make(map[string]bool)
+	errs := []string{}
+	running := 0
+
+	ch := make(chan done)
+
+	for _, j := range f.Jobs {
+		pending[j.Name] = true
+	}
+
+	for {
+		// Loop until no job can be started or skipped anymore.
+		// Skipping a job may unblock the jobs declared before it
+		progress := true
+		for progress {
+			progress = false
+
+			for _, j := range f.Jobs {
+				if !pending[j.Name] {
+					continue
+				}
+
+				ready, blocked := checkJobReady(j, finished, failed)
+				if !ready {
+					continue
+				}
+
+				delete(pending, j.Name)
+
+				if blocked {
+					f.skipJob(j, "needed job failed")
+					finished[j.Name] = true
+					failed[j.Name] = true
+					progress = true
+					continue
+				}
+
+				running++
+
+				go func(j *Job) {
+					log.Infoln("Executing job", j.Name)
+					ch <- done{job: j, err: f.execJob(j)}
+				}(j)
+			}
+		}
+
+		if running == 0 {
+			break
+		}
+
+		// Wait for a job to finish
+		d := <-ch
+		running--
+		finished[d.job.Name] = true
+
+		if d.err != nil {
+			log.Errorw("Job failed", "job", d.job.Name, "err", d.err)
+			failed[d.job.Name] = true
+			errs = append(errs, d.job.Name)
+		}
+	}
+
+	if len(failed) > 0 {
+		f.Status = FAILED
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d job(s) failed: %s", len(errs), strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+// runJob executes the job with the name given
+func (f *Flow) runJob(job string) error {
 	if job == "" {
 		err := fmt.Errorf("No job name is specified")
 		f.Status = FAILED
@@ -68,10 +330,17 @@ func (f *Flow) RunJob(job string) error {
 		return err
 	}
 
+	err := f.CheckHosts()
+	if err != nil {
+		f.Status = FAILED
+		log.Errorw(err.Error())
+		return err
+	}
+
 	// Loop jobs and exec job by job.
 	for _, j := range f.Jobs {
 		if j.Name == job {
-			err := f.execJob(j)
+			err = f.execJob(j)
 			if err != nil {
 				f.Status = FAILED
 				log.Errorw(err.Error())
@@ -83,90 +352,188 @@ func (f *Flow) RunJob(job string) error {
 	return nil
 }
 
-/////////// INTERNAL FUNCTIONS /////////////////////////:
-
 func (f *Flow) execJob(job *Job) error {
-	if job.Hosts == "" || job.Hosts == "localhost" || job.Hosts == "127.0.0.1" {
+	if job.isLocal() {
 		return f.execJobLocal(job)
 	}
 
 	return f.execJobRemote(job)
 }
 
+// isLocal returns true if the job is executed on the current host
+func (j *Job) isLocal() bool {
+	return j.Hosts == "" || j.Hosts == "localhost" || j.Hosts == "127.0.0.1"
+}
+
+// checkJobReady returns if all jobs needed by the job are finished
+// and if one of them failed
+func checkJobReady(j *Job, finished, failed map[string]bool) (bool, bool) {
+	ready := true
+	blocked := false
+
+	for _, need := range j.Needs {
+		if !finished[need] {
+			ready = false
+		}
+
+		if failed[need] {
+			blocked = true
+		}
+	}
+
+	return ready, blocked
+}
+
+// skipJob records the job as skipped in the flow result
+func (f *Flow) skipJob(j *Job, reason string) {
+	log.Infow("Job skipped", "job", j.Name, "reason", reason)
+
+	job := copyJob(j)
+	job.Status = SKIPPED
+	if job.isLocal() {
+		job.Hosts = "localhost"
+	}
+
+	f.addResult(job)
+}
+
+// addResult stores the executed job in the flow result
+// under its hosts
+func (f *Flow) addResult(j *Job) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.Result[j.Hosts] = append(f.Result[j.Hosts], j)
+}
+
 // execJobLocal executes job on the current host directly
 func (f *Flow) execJobLocal(j *Job) error {
 	job := copyJob(j)
 
 	job.Start = job.Tasks[0]
 
+	f.resumeJob(job, "localhost")
+	job.Check = job.Check || f.Check
+
 	// Set context to execute job
-	job.Context["variables"] = f.Variables
+	job.Context["variables"] = f.JobVariables(job, "localhost")
+	job.ExtraVars = f.extraVars()
+	f.setHost(job, "localhost")
+
+	// Job observers receive the events of flow observers too
+	job.observers = append(append([]Observer{}, f.observers...), j.observers...)
+
+	// Output is relayed by the local jobflow if it is on remote
+	job.OnOutput = f.OnOutput
+	if f.IsOnRemote {
+		job.OnOutput = printRemoteOutput
+	}
 
 	jobErr := job.Run("")
 
 	// Marshalling job result to print if it is on remote
 	// Store job result only when it is local
 	if f.IsOnRemote {
-		jobBytes, jsErr := json.Marshal(job.Result)
+		// Secrets are masked as the result is printed
+		result := make(map[string]*CmdResult, len(job.Result))
+		for name, res := range job.Result {
+			result[name] = MaskResult(res)
+		}
+
+		remote := remoteJobResult{
+			Status: job.Status,
+			Result: result,
+			Facts:  MaskMap(job.getFacts()),
+		}
+		if job.CleanupErr != nil {
+			remote.CleanupError = MaskSecrets(job.CleanupErr.Error())
+		}
+
+		jobBytes, jsErr := json.Marshal(remote)
 		if jsErr != nil {
 			fmt.Println(jsErr)
 		} else {
-			fmt.Println(string(jobBytes))
+			fmt.Println(remoteResultMarker + string(jobBytes))
 		}
 	} else {
 		job.Hosts = "localhost"
-		f.Result["localhost"] = append(f.Result["localhost"], job)
+		f.addResult(job)
 	}
 
 	return jobErr
 }
 
-// execJobRemote executes job on remote hosts
+// execJobRemote executes job on remote hosts.
+//
+// Hosts of a group are executed in batches following the job serial.
+// Remaining batches are skipped when the percentage of hosts failed
+// in a batch exceeds the job MaxFailPercentage.
 func (f *Flow) execJobRemote(j *Job) error {
-	var count int
+	hosts, err := f.jobHosts(j)
+	if err != nil {
+		log.Errorw("Invalid job hosts", "job", j.Name, "hosts", j.Hosts, "err", err)
+		return err
+	}
 
-	channel := make(chan *Job)
+	if len(hosts) == 0 {
+		log.Warnw("No hosts matched", "job", j.Name, "hosts", j.Hosts, "limit", f.Limit)
+		return nil
+	}
 
-	// Check if job hosts is a group or only a host
-	// If it is a group, loop all hosts to init a ssh client
-	group, ok := f.Inventory.Groups[j.Hosts]
-	if ok {
-		for _, hostname := range group.Hosts {
-			job := copyJob(j)
-			job.Hosts = hostname
+	batches, err := serialBatches(j.Serial, hosts)
+	if err != nil {
+		log.Errorw("Invalid job serial", "job", j.Name, "err", err)
+		return err
+	}
 
-			go f.execJobViaSSH(job, channel)
-		}
+	failed := []string{}
+	stop := false
 
-		count = len(group.Hosts)
-	} else {
-		job := copyJob(j)
+	for i, batch := range batches {
+		if stop {
+			for _, hostname := range batch {
+				job := copyJob(j)
+				job.Hosts = hostname
+				job.Batch = i + 1
+				job.Status = SKIPPED
 
-		go f.execJobViaSSH(job, channel)
+				f.addResult(job)
+			}
 
-		count = 1
-	}
+			continue
+		}
 
-	for i := 0; i < count; i++ {
-		j := <-channel
+		log.Infow("Executing job batch", "job", j.Name, "batch", i+1, "batches", len(batches), "hosts", batch)
 
-		// Store job result
-		f.Result[j.Hosts] = append(f.Result[j.Hosts], j)
-	}
+		batchFailed := 0
+		for _, job := range f.execBatch(j, batch, i+1) {
+			// Store job result
+			f.addResult(job)
 
-	for k, v := range f.Result {
-		fmt.Println(k, ":")
-		for _, j := range v {
-			fmt.Printf("\t%s:\n", j.Name)
-			for k, v := range j.Result {
-				fmt.Printf("\t\t%s: %+v\n", k, v)
+			if job.Status != SUCCESS {
+				failed = append(failed, job.Hosts)
+				batchFailed++
 			}
+
+			log.Debugw("Job result", "job", job.Name, "hosts", job.Hosts, "result", job.Result)
+		}
+
+		if j.MaxFailPercentage >= 0 && float64(batchFailed*100) > j.MaxFailPercentage*float64(len(batch)) {
+			log.Errorw("Stopping job batches", "job", j.Name, "batch", i+1, "failed", batchFailed, "max_fail_percentage", j.MaxFailPercentage)
+			stop = true
 		}
 	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("job %s failed on %d host(s): %s", j.Name, len(failed), strings.Join(failed, ", "))
+	}
+
 	return nil
 }
 
-func (f *Flow) execJobViaSSH(j *Job, ch chan *Job) {
+// execJobViaSSH copies the jobflow binary and the job on the remote
+// host of the job, executes it and stores its result in the job
+func (f *Flow) execJobViaSSH(j *Job) error {
 	var config *gossh.Config
 	var err error
 
@@ -174,11 +541,23 @@ func (f *Flow) execJobViaSSH(j *Job, ch chan *Job) {
 
 	logger.Infow("REMOTE JOB RUN STARTED", "job", j.Name, "hosts", j.Hosts)
 
+	if f.Inventory == nil {
+		logger.Errorw("No inventory", "host", j.Hosts)
+		return fmt.Errorf("no inventory to find host %s", j.Hosts)
+	}
+
 	host, ok := f.Inventory.Hosts[j.Hosts]
 	if !ok {
 		logger.Errorw("Host not found", "host", j.Hosts)
-		j.Status = FAILED
-		return
+		return fmt.Errorf("host %s not found", j.Hosts)
+	}
+
+	// Host variables with a secret name, such as the ssh
+	// password, are masked in logs and outputs
+	for name, value := range host.Vars {
+		if IsSecretName(name) {
+			addSecretValues(value, addNamedSecret)
+		}
 	}
 
 	logger.Infow("Etablishing ssh connection", "job", j.Name, "hosts", j.Hosts)
@@ -193,31 +572,24 @@ func (f *Flow) execJobViaSSH(j *Job, ch chan *Job) {
 		config, err = gossh.NewClientConfigWithKeyFile(sshUser, sshPrivkey, sshHost, sshPort, false)
 		if err != nil {
 			logger.Errorw("Error SSH connection", "user", sshUser, "host", sshHost, "port", sshPort, "privkey", sshPrivkey, "err", err)
-			j.Status = FAILED
-			ch <- j
-			return
+			return err
 		}
 	} else if sshPass != "" {
 		config, err = gossh.NewClientConfigWithUserPass(sshUser, sshPass, sshHost, sshPort, false)
 		if err != nil {
 			logger.Errorw("Error SSH connection", "user", sshUser, "host", sshHost, "port", sshPort, "pass", "********", "err", err)
-			j.Status = FAILED
-			ch <- j
-			return
+			return err
 		}
 	} else {
 		logger.Errorw("No ssh password or private key is specified for connection")
-		j.Status = FAILED
-		ch <- j
-		return
+		return fmt.Errorf("no ssh password or private key for host %s", j.Hosts)
 	}
 
 	client, err := gossh.NewClient(config)
 	if err != nil {
 		logger.Errorw("Error creating SSH client", "user", sshUser, "host", sshHost, "port", sshPort, "err", err)
-		j.Status = FAILED
-		ch <- j
-		return
+		j.notify(&HostUnreachable{Job: j, Host: j.Hosts, Time: time.Now(), Error: err})
+		return err
 	}
 
 	logger.Infow("Transfering jobflow binary", "job", j.Name, "hosts", j.Hosts)
@@ -228,9 +600,7 @@ func (f *Flow) execJobViaSSH(j *Job, ch chan *Job) {
 		//dirAbsPath = filepath.Dir(ex)
 		//fmt.Println(ex)
 		logger.Errorw("Error getting current binary path", "err", err)
-		j.Status = FAILED
-		ch <- j
-		return
+		return err
 	}
 
 	// Random string
@@ -242,34 +612,24 @@ func (f *Flow) execJobViaSSH(j *Job, ch chan *Job) {
 	_, err = client.ExecCommand("mkdir -p " + remoteDir)
 	if err != nil {
 		logger.Errorw("Failed to create a remote folder", "dir", remoteDir, "err", err)
-		j.Status = FAILED
-		ch <- j
-		return
+		return err
 	}
 
 	// Defer function to clean up remote machine
-	// and send final job to channel
 	defer func() {
 		logger.Infow("Clean up remote machine", "job", j.Name, "hosts", j.Hosts, "dir", remoteDir)
 		//Remove tmp folder on remote machine
-		_, err = client.ExecCommand("rm -rf " + remoteDir)
-		if err != nil {
-			logger.Errorw("Failed to remove folder on remote machine", "dir", remoteDir, "err", err)
-			j.Status = FAILED
-			ch <- j
-			return
+		_, rmErr := client.ExecCommand("rm -rf " + remoteDir)
+		if rmErr != nil {
+			logger.Errorw("Failed to remove folder on remote machine", "dir", remoteDir, "err", rmErr)
 		}
-
-		ch <- j
 	}()
 
 	// SCP jobflow binary from local machine to remote machine
 	err = client.SCPFile(exec, remoteDir+"/"+binExec, "0755")
 	if err != nil {
 		logger.Errorw("Failed to scp file to remote machine", "exec", exec, "err", err)
-		j.Status = FAILED
-		ch <- j
-		return
+		return err
 	}
 
 	logger.Infow("Generating local flow file", "job", j.Name, "hosts", j.Hosts)
@@ -278,18 +638,14 @@ func (f *Flow) execJobViaSSH(j *Job, ch chan *Job) {
 	newFlow, err := f.generateLocalFlowRemoteMachine(j)
 	if err != nil {
 		logger.Errorw("Failed to generate new local flow file for remote machine", "err", err)
-		j.Status = FAILED
-		ch <- j
-		return
+		return err
 	}
 
 	logger.Infow("Transfering local flow file", "job", j.Name, "hosts", j.Hosts)
 	err = client.SCPBytes(newFlow, remoteDir+"/flow.yml", "0755")
 	if err != nil {
 		logger.Errorw("Failed to scp new flow file to remote machine", "err", err)
-		j.Status = FAILED
-		ch <- j
-		return
+		return err
 	}
 
 	//time.Sleep(time.Second * 5)
@@ -297,61 +653,244 @@ func (f *Flow) execJobViaSSH(j *Job, ch chan *Job) {
 	logger.Infow("Executing remote jobflow", "job", j.Name, "hosts", j.Hosts)
 	// Execute jobflow on remote machine with new location
 	remoteCmd := remoteDir + "/" + binExec + " exec --verbosity 0 " + remoteDir + "/flow.yml"
-	remoteRes, err := client.ExecCommand(remoteCmd)
+	if j.Check {
+		remoteCmd += " --check"
+	}
+	// Output lines are relayed as soon as they are received. The remote
+	// jobflow exits with an error when the job failed, its output
+	// contains the job result anyway
+	var remote *remoteJobResult
+
+	execErr := streamRemoteCommand(client, remoteCmd, func(line string) {
+		res, lineErr := readRemoteLine(line, f.OnOutput, j.Hosts)
+		if lineErr != nil {
+			logger.Errorw("Failed to read remote output", "job", j.Name, "hosts", j.Hosts, "line", line, "err", lineErr)
+			return
+		}
+
+		if res != nil {
+			remote = res
+		}
+	})
+
+	if remote == nil {
+		if execErr != nil {
+			logger.Errorw("Failed to execute flow file on remote machine", "job", j.Name, "hosts", j.Hosts, "err", execErr)
+			return execErr
+		}
+
+		logger.Errorw("No remote job result", "job", j.Name, "hosts", j.Hosts)
+		return fmt.Errorf("no job result received from host %s", j.Hosts)
+	}
+
+	j.Result = remote.Result
+	j.Status = remote.Status
+	j.setFacts(remote.Facts)
+	if remote.CleanupError != "" {
+		j.CleanupErr = errors.New(remote.CleanupError)
+	}
+
+	if j.Status == FAILED {
+		return fmt.Errorf("job %s failed on host %s", j.Name, j.Hosts)
+	}
+
+	return nil
+}
+
+// streamRemoteCommand executes a command through the ssh client
+// and calls the function given for each line of its standard
+// output as soon as it is received
+func streamRemoteCommand(client *gossh.Client, cmd string, fn func(string)) error {
+	session, err := client.Client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	stdout, err := session.StdoutPipe()
 	if err != nil {
-		logger.Errorw("Failed to execute flow file on remote machine", "job", j.Name, "hosts", j.Hosts, "err", err)
-		j.Status = FAILED
-		ch <- j
-		return
+		return err
+	}
+
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+
+	err = session.Start(cmd)
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		fn(scanner.Text())
 	}
 
-	// Unmarshalling remote result to store in current job locally
-	err = json.Unmarshal(remoteRes, &j.Result)
+	err = session.Wait()
 	if err != nil {
-		logger.Errorw("Failed to unmarshal remote job result", "res", string(remoteRes))
-		j.Status = FAILED
-		ch <- j
-		return
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
 	}
+
+	return scanner.Err()
 }
 
 func (f *Flow) generateLocalFlowRemoteMachine(j *Job) ([]byte, error) {
 	mFlow := make(map[string]interface{})
 	job := make(map[string]interface{})
-	tasks := []map[string]interface{}{}
 	jobs := []interface{}{}
 
 	mFlow["on_remote"] = "true"
-	mFlow["variables"] = f.Variables
-
-	// Tasks
-	for _, t := range j.Tasks {
-		task := make(map[string]interface{})
-		task["name"] = t.Name
-
-		// Extract plugin & cmd name from cmd
-		plugin := make(map[string]interface{})
-		plugin["cmd"] = t.Cmd.Name
-		plugin["params"] = t.Params
-		if t.OnSuccess != "" {
-			plugin["on_success"] = t.OnSuccess
-		}
-		if t.OnFailure != "" {
-			plugin["on_failure"] = t.OnFailure
-		}
+	// Inventory variables of the host are merged in the flow
+	// variables as the remote flow has no inventory
+	mFlow["variables"] = mergeVarLayers(append(f.hostVarLayers(j.Hosts), VarLayer{Vars: f.Variables}))
+
+	if extra := f.extraVars(); len(extra) > 0 {
+		mFlow["extra_vars"] = extra
+	}
+
+	// Inventory data of the hosts available in templates
+	mFlow["host"] = f.hostData(j.Hosts)
+	mFlow["hostvars"] = f.remoteHostVars(j.Hosts)
+
+	if len(f.Secrets) > 0 {
+		mFlow["secrets"] = f.Secrets
+	}
+
+	if len(f.SecretPatterns) > 0 {
+		mFlow["secret_patterns"] = f.SecretPatterns
+	}
+
+	job["tasks"] = tasksToList(j.Tasks)
+	if len(j.Always) > 0 {
+		job["always"] = tasksToList(j.Always)
+	}
+
+	if j.Timeout > 0 {
+		job["timeout"] = j.Timeout.String()
+	}
+
+	if j.MaxParallel > 0 {
+		job["max_parallel"] = j.MaxParallel
+	}
 
-		task[t.Cmd.Plugin.Name] = plugin
+	if len(j.Variables) > 0 {
+		job["variables"] = j.Variables
+	}
+
+	if j.FailFast {
+		job["fail_fast"] = j.FailFast
+	}
+
+	// Results of the previous run are encoded in JSON
+	// to be decoded as command results
+	if len(j.Resume) > 0 {
+		resume, err := json.Marshal(j.Resume)
+		if err != nil {
+			return nil, err
+		}
 
-		tasks = append(tasks, task)
+		job["resume"] = string(resume)
 	}
 
-	job["tasks"] = tasks
 	jobs = append(jobs, job)
 	mFlow["jobs"] = jobs
 
 	return yaml.Marshal(mFlow)
 }
 
+// taskToMap converts a task into a map with the same
+// structure as in the flow file
+func taskToMap(t *Task) map[string]interface{} {
+	task := make(map[string]interface{})
+	task["name"] = t.Name
+
+	if len(t.DependsOn) > 0 {
+		task["depends_on"] = t.DependsOn
+	}
+
+	if t.Timeout > 0 {
+		task["timeout"] = t.Timeout.String()
+	}
+
+	if t.Retries > 0 {
+		task["retries"] = t.Retries
+	}
+
+	if t.Delay > 0 {
+		task["delay"] = t.Delay.String()
+	}
+
+	if t.Backoff != "" {
+		task["backoff"] = t.Backoff
+	}
+
+	if t.Until != "" {
+		task["until"] = t.Until
+	}
+
+	if t.When != "" {
+		task["when"] = t.When
+	}
+
+	if len(t.Vars) > 0 {
+		task["vars"] = t.Vars
+	}
+
+	if t.Loop != nil {
+		task["loop"] = t.Loop
+	}
+
+	if t.LoopParallel > 0 {
+		task["loop_parallel"] = t.LoopParallel
+	}
+
+	if t.BreakOnError {
+		task["break_on_error"] = t.BreakOnError
+	}
+
+	if t.Register != "" {
+		task["register"] = t.Register
+	}
+
+	// A group has no command
+	if t.isGroup() {
+		task["block"] = tasksToList(t.Block)
+		if len(t.Rescue) > 0 {
+			task["rescue"] = tasksToList(t.Rescue)
+		}
+		if len(t.Always) > 0 {
+			task["always"] = tasksToList(t.Always)
+		}
+
+		return task
+	}
+
+	// Extract plugin & cmd name from cmd
+	plugin := make(map[string]interface{})
+	plugin["cmd"] = t.Cmd.Name
+	plugin["params"] = t.Params
+	if t.OnSuccess != "" {
+		plugin["on_success"] = t.OnSuccess
+	}
+	if t.OnFailure != "" {
+		plugin["on_failure"] = t.OnFailure
+	}
+
+	task[t.Cmd.Plugin.Name] = plugin
+
+	return task
+}
+
+// tasksToList converts a list of tasks into a list of maps
+func tasksToList(tasks []*Task) []map[string]interface{} {
+	list := []map[string]interface{}{}
+	for _, t := range tasks {
+		list = append(list, taskToMap(t))
+	}
+
+	return list
+}
+
 func randomString(n int) string {
 	var letter = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
 
@@ -368,8 +907,24 @@ func copyJob(j *Job) *Job {
 	job.Hosts = j.Hosts
 	job.Start = j.Start
 	job.Tasks = j.Tasks
-
-	job.Context = j.Context
+	job.Always = j.Always
+	job.Timeout = j.Timeout
+	job.MaxParallel = j.MaxParallel
+	job.FailFast = j.FailFast
+	job.Needs = j.Needs
+	job.Variables = j.Variables
+	job.ExtraVars = j.ExtraVars
+	job.Serial = j.Serial
+	job.observers = j.observers
+	job.MaxFailPercentage = j.MaxFailPercentage
+	job.Resume = j.Resume
+	job.Check = j.Check
+
+	// Copy the context so that facts set by a job execution
+	// are not shared with other hosts
+	for k, v := range j.Context {
+		job.Context[k] = v
+	}
 
 	return job
 }
@@ -0,0 +1,155 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newFlowJob(name string, needs []string, fn CmdFunc) *Job {
+	j := NewJob(name)
+	j.Hosts = "localhost"
+	j.Needs = needs
+	j.AddTask(&Task{Name: name + "-task", Cmd: Cmd{Func: fn}})
+
+	return j
+}
+
+func TestRunAllJobs(t *testing.T) {
+	var mutex sync.Mutex
+	var running, maxRunning int
+
+	ok := func(ctx context.Context, m map[string]interface{}) *CmdResult {
+		mutex.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mutex.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+
+		return &CmdResult{Error: nil, Result: map[string]interface{}{}}
+	}
+
+	nok := func(ctx context.Context, m map[string]interface{}) *CmdResult {
+		return &CmdResult{Error: errors.New("NOK"), Result: map[string]interface{}{}}
+	}
+
+	f := NewFlow()
+	f.Jobs = []*Job{
+		newFlowJob("package", []string{"build", "test"}, ok),
+		newFlowJob("build", nil, ok),
+		newFlowJob("lint", nil, ok),
+		newFlowJob("test", nil, nok),
+		newFlowJob("release", []string{"package"}, ok),
+	}
+
+	err := f.RunAllJobs()
+	assert.NotNil(t, err)
+	assert.Equal(t, FAILED, f.Status)
+	assert.Equal(t, 2, maxRunning)
+
+	statuses := make(map[string]int)
+	for _, j := range f.Result["localhost"] {
+		statuses[j.Name] = j.Status
+	}
+
+	assert.Equal(t, map[string]int{
+		"build":   SUCCESS,
+		"lint":    SUCCESS,
+		"test":    FAILED,
+		"package": SKIPPED,
+		"release": SKIPPED,
+	}, statuses)
+}
+
+func TestCheckJobs(t *testing.T) {
+	fn := func(ctx context.Context, m map[string]interface{}) *CmdResult {
+		return &CmdResult{Error: nil, Result: map[string]interface{}{}}
+	}
+
+	testCases := []struct {
+		name string
+		jobs []*Job
+		err  bool
+	}{
+		{
+			"Valid",
+			[]*Job{newFlowJob("a", nil, fn), newFlowJob("b", []string{"a"}, fn)},
+			false,
+		},
+		{
+			"Duplicate",
+			[]*Job{newFlowJob("a", nil, fn), newFlowJob("a", nil, fn)},
+			true,
+		},
+		{
+			"UnknownJob",
+			[]*Job{newFlowJob("a", []string{"x"}, fn)},
+			true,
+		},
+		{
+			"Cycle",
+			[]*Job{newFlowJob("a", []string{"b"}, fn), newFlowJob("b", []string{"a"}, fn)},
+			true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := NewFlow()
+			f.Jobs = tc.jobs
+
+			err := f.CheckJobs()
+			assert.Equal(t, tc.err, err != nil, "%v", err)
+		})
+	}
+}
+
+func TestJobVariables(t *testing.T) {
+	var version, env interface{}
+
+	get := func(ctx context.Context, m map[string]interface{}) *CmdResult {
+		version = m["version"]
+		env = m["env"]
+
+		return &CmdResult{Result: map[string]interface{}{}}
+	}
+
+	j := NewJob("job1")
+	j.Variables = map[string]interface{}{"env": "prod"}
+	j.AddTask(&Task{
+		Name: "task1",
+		Cmd:  Cmd{Func: get},
+		Params: map[string]interface{}{
+			"version": "{{ .context.variables.version }}",
+			"env":     "{{ .context.variables.env }}",
+		},
+	})
+
+	f := NewFlow()
+	f.OnOutput = nil
+	f.Variables = map[string]interface{}{"version": "1.0", "env": "dev"}
+	f.Jobs = []*Job{j}
+
+	err := f.RunAllJobs()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.0", version)
+	assert.Equal(t, "prod", env)
+
+	// Flow variables are not modified by job variables
+	assert.Equal(t, "dev", f.Variables["env"])
+
+	content, err := f.generateLocalFlowRemoteMachine(j)
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "env: prod")
+}
@@ -0,0 +1,85 @@
+package job
+
+//////////////// INTERNAL FUNCTIONS ////////////////////
+
+// hostData returns the name, vars and groups of the host available
+// in templates as .host. On a remote flow, they are the ones given
+// by the local flow as the inventory is not available.
+func (f *Flow) hostData(name string) map[string]interface{} {
+	if f.Host != nil {
+		return normalizeMap(f.Host)
+	}
+
+	data := map[string]interface{}{
+		"name":   name,
+		"vars":   map[string]interface{}{},
+		"groups": []interface{}{},
+	}
+
+	if f.Inventory == nil {
+		return data
+	}
+
+	data["vars"] = normalizeMap(f.Inventory.Global)
+
+	if h, ok := f.Inventory.Hosts[name]; ok {
+		groups := []interface{}{}
+		for _, g := range h.Groups {
+			groups = append(groups, g)
+		}
+
+		data["vars"] = normalizeMap(h.Vars)
+		data["groups"] = groups
+	}
+
+	return data
+}
+
+// hostVarsData returns the vars of all inventory hosts by host name,
+// available in templates as .hostvars. Hosts can read the vars of
+// each other but they are copies so that the inventory is unchanged.
+func (f *Flow) hostVarsData() map[string]interface{} {
+	if f.HostVars != nil {
+		return normalizeMap(f.HostVars)
+	}
+
+	data := make(map[string]interface{})
+
+	if f.Inventory == nil {
+		return data
+	}
+
+	for name, h := range f.Inventory.Hosts {
+		data[name] = normalizeMap(h.Vars)
+	}
+
+	return data
+}
+
+// remoteHostVars returns the vars of all inventory hosts sent to
+// the remote host given. Secret vars of other hosts, such as their
+// ssh passwords, are not sent.
+func (f *Flow) remoteHostVars(host string) map[string]interface{} {
+	data := f.hostVarsData()
+
+	for name, vars := range data {
+		if name == host {
+			continue
+		}
+
+		m := vars.(map[string]interface{})
+		for k := range m {
+			if IsSecretName(k) {
+				delete(m, k)
+			}
+		}
+	}
+
+	return data
+}
+
+// setHost sets the data of the host on which the job is executed
+func (f *Flow) setHost(job *Job, host string) {
+	job.Host = f.hostData(host)
+	job.HostVars = f.hostVarsData()
+}
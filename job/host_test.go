@@ -0,0 +1,106 @@
+package job
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func newHostInventory() *Inventory {
+	inventory := NewInventory()
+	inventory.Groups["web"] = Group{Name: "web", Hosts: []string{"localhost", "web1"}}
+	inventory.Hosts["localhost"] = Host{
+		Name:   "localhost",
+		Groups: []string{"web"},
+		Vars:   map[string]interface{}{"app_port": 8080},
+	}
+	inventory.Hosts["web1"] = Host{
+		Name:   "web1",
+		Groups: []string{"web"},
+		Vars:   map[string]interface{}{"app_port": 9090, "jobflow_ssh_pass": "pass-web1"},
+	}
+
+	return inventory
+}
+
+func TestHostTemplates(t *testing.T) {
+	var params map[string]interface{}
+
+	get := func(ctx context.Context, m map[string]interface{}) *CmdResult {
+		params = m
+		return NewCmdResult()
+	}
+
+	// Host data modified by a task are not seen by the next tasks
+	j := NewJob("job1")
+	j.AddTask(&Task{
+		Name:      "task1",
+		Cmd:       Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult { return NewCmdResult() }},
+		Params:    map[string]interface{}{"set": "{{ set .hostvars.web1 \"app_port\" 1 | len }}"},
+		OnSuccess: "task2",
+	})
+	j.AddTask(&Task{
+		Name: "task2",
+		Cmd:  Cmd{Func: get},
+		Params: map[string]interface{}{
+			"name":   "{{ .host.name }}",
+			"port":   "{{ .host.vars.app_port }}",
+			"groups": "{{ .host.groups | join \",\" }}",
+			"other":  "{{ .hostvars.web1.app_port }}",
+		},
+	})
+
+	f := NewFlow()
+	f.OnOutput = nil
+	f.Inventory = newHostInventory()
+	f.Jobs = []*Job{j}
+
+	err := f.RunAllJobs()
+	assert.Nil(t, err)
+	assert.Equal(t, "localhost", params["name"])
+	assert.Equal(t, 8080, params["port"])
+	assert.Equal(t, "web", params["groups"])
+	assert.Equal(t, 9090, params["other"])
+
+	// Templates cannot modify the inventory
+	assert.Equal(t, 9090, f.Inventory.Hosts["web1"].Vars["app_port"])
+}
+
+func TestGenerateRemoteFlowHost(t *testing.T) {
+	j := NewJob("job1")
+	j.Hosts = "web1"
+	j.AddTask(&Task{Name: "task1", Cmd: Cmd{Name: "cmd", Plugin: Plugin{Name: "plugin"}}})
+
+	f := NewFlow()
+	f.Inventory = newHostInventory()
+
+	content, err := f.generateLocalFlowRemoteMachine(j)
+	assert.Nil(t, err)
+
+	flow := make(map[string]interface{})
+	assert.Nil(t, yaml.Unmarshal(content, &flow))
+
+	host := cast.ToStringMap(flow["host"])
+	assert.Equal(t, "web1", host["name"])
+	assert.Equal(t, []interface{}{"web"}, host["groups"])
+	assert.Equal(t, "pass-web1", cast.ToStringMap(host["vars"])["jobflow_ssh_pass"])
+
+	hostvars := cast.ToStringMap(flow["hostvars"])
+	assert.Equal(t, 8080, cast.ToStringMap(hostvars["localhost"])["app_port"])
+	assert.Equal(t, 9090, cast.ToStringMap(hostvars["web1"])["app_port"])
+
+	// Secret vars of other hosts are not sent
+	assert.Equal(t, "pass-web1", cast.ToStringMap(hostvars["web1"])["jobflow_ssh_pass"])
+	assert.NotContains(t, f.remoteHostVars("localhost")["web1"], "jobflow_ssh_pass")
+
+	// Remote flows use the host data given instead of the inventory
+	remote := NewFlow()
+	remote.Host = cast.ToStringMap(flow["host"])
+	remote.HostVars = hostvars
+
+	assert.Equal(t, "web1", remote.hostData("localhost")["name"])
+	assert.Equal(t, 8080, cast.ToStringMap(remote.hostVarsData()["localhost"])["app_port"])
+}
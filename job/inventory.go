@@ -17,12 +17,17 @@ type Host struct {
 	Vars   map[string]interface{}
 }
 
-// Group describes attributes of a group
+// Group describes attributes of a group. Hosts of the children
+// groups are hosts of the group too. Vars of a child group override
+// the ones of its parents and, between groups of a same depth, the
+// vars of the group with the highest priority win
 type Group struct {
 	Name string
 
-	Hosts []string
-	Vars  map[string]interface{}
+	Hosts    []string
+	Children []string
+	Priority int
+	Vars     map[string]interface{}
 }
 
 // Inventory describes attributes of a host inventory
@@ -44,3 +49,31 @@ func NewInventory() *Inventory {
 
 	return inventory
 }
+
+// GroupHosts returns the hosts of the group and of its
+// children groups, recursively, in the order they are listed
+func (inv *Inventory) GroupHosts(name string) []string {
+	return inv.groupHosts(name, map[string]bool{})
+}
+
+//////////////// INTERNAL FUNCTIONS ////////////////////
+
+// groupHosts returns the hosts of the group and its children
+// which are not visited yet. Visited groups stop cycles
+func (inv *Inventory) groupHosts(name string, visited map[string]bool) []string {
+	hosts := []string{}
+
+	g, ok := inv.Groups[name]
+	if !ok || visited[name] {
+		return hosts
+	}
+
+	visited[name] = true
+
+	hosts = appendHosts(hosts, g.Hosts...)
+	for _, child := range g.Children {
+		hosts = appendHosts(hosts, inv.groupHosts(child, visited)...)
+	}
+
+	return hosts
+}
@@ -2,16 +2,19 @@ package job
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"math"
+	"math/rand"
 	"os"
 	"reflect"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
 
-	"github.com/Masterminds/sprig"
 	"github.com/spf13/cast"
 
-	log "github.com/uthng/golog"
 	utils "github.com/uthng/goutils"
 )
 
@@ -21,6 +24,16 @@ const (
 	FAILED = iota
 	// SUCCESS when all tasks succedded
 	SUCCESS
+	// SKIPPED when a task was not executed
+	SKIPPED
+)
+
+const (
+	// BackoffFixed waits the same delay before each retry
+	BackoffFixed = "fixed"
+	// BackoffExponential doubles the delay before each retry
+	// and adds a random jitter
+	BackoffExponential = "exponential"
 )
 
 // Job describes structure of a job
@@ -29,11 +42,82 @@ type Job struct {
 	Hosts string
 	Start *Task
 
+	// Needs is the list of jobs of the flow which must succeed
+	// before the job can be executed
+	Needs []string
+
+	// Serial is the list of batch sizes used to execute the job
+	// on the hosts of a group. A size is a number of hosts or a
+	// percentage such as "25%". The last size is repeated until all
+	// hosts are executed. All hosts are executed at once if it is empty
+	Serial []string
+	// MaxFailPercentage is the percentage of hosts failed in a batch
+	// above which the next batches are skipped. Disabled if negative
+	MaxFailPercentage float64
+	// Batch is the number of the batch, starting from 1, in which
+	// the job was executed on its host
+	Batch int
+
+	// Timeout is the maximum duration of the whole job.
+	// No timeout if it is 0
+	Timeout time.Duration
+
+	// MaxParallel is the maximum number of tasks executed at the
+	// same time when tasks declare dependencies. No limit if it is 0
+	MaxParallel int
+	// FailFast stops all tasks as soon as a task fails
+	// when tasks declare dependencies
+	FailFast bool
+
+	// Variables are the variables of the job. They override
+	// the flow variables with the same name
+	Variables map[string]interface{}
+	// ExtraVars are the variables overriding task vars
+	ExtraVars map[string]interface{}
+
+	// Host is the name, vars and groups of the inventory host
+	// on which the job is executed, available in templates as .host
+	Host map[string]interface{}
+	// HostVars are the vars of all inventory hosts by
+	// host name, available in templates as .hostvars
+	HostVars map[string]interface{}
+
 	Tasks   []*Task
 	Context map[string]interface{}
 
+	// Always is the list of tasks executed after the main tasks
+	// whatever their result, for example to clean up resources
+	Always []*Task
+
 	Status int
 	Result map[string]*CmdResult
+
+	// Error is the error of the job execution on its host
+	Error error
+	// Duration is the time taken by the job execution on its host
+	Duration time.Duration
+
+	// Check executes the job in check mode: commands report the
+	// actions they would perform and those not supporting it are skipped
+	Check bool
+
+	// Resume contains the task results of a previous run. Tasks
+	// succeeded in it are not executed again, their results are restored
+	Resume map[string]*CmdResult
+
+	// CleanupErr is the error of always tasks. It does not
+	// change the job status which reflects the main tasks
+	CleanupErr error
+
+	// OnOutput receives the output lines of task commands as soon
+	// as they are written. Output is kept in command results anyway
+	OnOutput OutputFunc
+
+	// observers receive the events of the job execution
+	observers []Observer
+
+	// mutex protects Result when tasks are executed in parallel
+	mutex sync.RWMutex
 }
 
 // Task describes attributes of a task
@@ -43,10 +127,81 @@ type Task struct {
 	Params    map[string]interface{}
 	OnSuccess string
 	OnFailure string
+
+	// DependsOn is the list of tasks which must succeed before
+	// the task can be executed. A job cannot mix dependencies
+	// with OnSuccess and OnFailure
+	DependsOn []string
+
+	// Timeout is the maximum duration of the task command.
+	// No timeout if it is 0
+	Timeout time.Duration
+
+	// Retries is the number of times the command is executed again
+	// when it fails or when its Until condition is not met
+	Retries int
+	// Delay is the duration to wait before retrying
+	Delay time.Duration
+	// Backoff is the strategy used to compute delays between retries:
+	// BackoffFixed (default) or BackoffExponential
+	Backoff string
+	// Until is a template condition evaluated after each attempt.
+	// The attempt result is available as .current
+	Until string
+
+	// When is a template condition evaluated before executing the task.
+	// If it is false, the task is skipped and considered as succeeded
+	When string
+
+	// Vars are the variables of the task. They override the job
+	// variables in the templates of the task
+	Vars map[string]interface{}
+
+	// Loop is a list of items or a template resolving to a list.
+	// The command is executed once per item, with .item and .index
+	// available in param templates
+	Loop interface{}
+	// LoopParallel is the number of loop items executed at the same time.
+	// Items are executed one by one if it is 0
+	LoopParallel int
+	// BreakOnError stops the loop at the first item failed
+	BreakOnError bool
+
+	// Register is the name of the fact under which the task
+	// result is stored in the job context
+	Register string
+
+	// Block is a list of tasks executed one by one as a group.
+	// A task with a block has no command
+	Block []*Task
+	// Rescue is the list of tasks executed when a block task fails.
+	// The group succeeds if they succeed
+	Rescue []*Task
+	// Always is the list of tasks executed after the block
+	// and rescue tasks whatever their result
+	Always []*Task
+}
+
+// TimeoutError is the error set in CmdResult when a task
+// is interrupted because it or its job exceeded its timeout
+type TimeoutError struct {
+	Task    string
+	Timeout time.Duration
 }
 
 ////////// DEFINITION OF ALL FUNCTIONS ///////////////////////////
 
+// Error returns the message of timeout error
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("task %s timed out after %s", e.Task, e.Timeout)
+}
+
+// IsTimeout returns true if the error is a task timeout error
+func IsTimeout(err error) bool {
+	_, ok := err.(*TimeoutError)
+	return ok
+}
+
 // NewJob instancies a new Job
 func NewJob(name string) *Job {
 	job := &Job{
@@ -54,6 +209,8 @@ func NewJob(name string) *Job {
 		Context: make(map[string]interface{}),
 		Status:  SUCCESS,
 		Result:  make(map[string]*CmdResult),
+
+		MaxFailPercentage: -1,
 	}
 
 	return job
@@ -64,38 +221,27 @@ func NewJob(name string) *Job {
 // Firstly, it checks to ensure that all task's names
 // are valid task.fmt_unicode
 //
+// Observers receive JobStarted and JobFinished events
+// around the execution.
 func (job *Job) Run(tasks string) error {
-	var err error
+	start := time.Now()
+	job.notify(&JobStarted{Job: job, Host: job.Hosts, Time: start})
 
-	log.Infow("JOB RUN STARTED", "job", job.Name, "hosts", job.Hosts)
-	log.Debugw("Job context", "context", job.Context)
-
-	// Check the name of all tasks indicated in taskflow
-	err = job.CheckTasks()
-	if err != nil {
-		job.Status = FAILED
-		log.Errorw(err.Error())
-		return err
-	}
-
-	// Run certain tasks given in parameter
-	if tasks != "" {
-		err = job.RunTaskByTask(tasks)
-	} else {
-		// Run complete taskflow by running the first task
-		err = job.RunAllTasks(job.Start)
-	}
+	err := job.run(tasks)
 
-	if err != nil {
-		job.Status = FAILED
-		log.Errorw("JOB RUN FAILED", "job", job.Name)
-		return err
-	}
+	job.Error = err
+	job.Duration = time.Since(start)
 
-	log.Debugw("Job result", "result", job.Result)
-	log.Infow("JOB RUN COMPLETED", "job", job.Name, "hosts", job.Hosts)
+	job.notify(&JobFinished{
+		Job:      job,
+		Host:     job.Hosts,
+		Time:     time.Now(),
+		Status:   job.Status,
+		Error:    err,
+		Duration: job.Duration,
+	})
 
-	return nil
+	return err
 }
 
 // AddTask adds a new task to the job
@@ -113,39 +259,35 @@ func (job *Job) AddTask(task *Task) {
 // in command line parameter. It return error if a task fails.
 //
 // In this function, task's OnSuccess or OnFailure are ignored.
-func (job *Job) RunTaskByTask(tasks string) error {
+func (job *Job) RunTaskByTask(ctx context.Context, tasks string) error {
 	for _, task := range strings.Split(tasks, ",") {
 		log.Infow("Task running", "task", task)
 
+		if ctx.Err() != nil {
+			err := job.timeoutError(task)
+			log.Errorw("Task not started", "task", task, "err", err)
+			return err
+		}
+
 		t, err := job.GetTaskByName(task)
 		if t == nil {
 			log.Errorw(err.Error())
 			return err
 		}
 
-		if t.Cmd.Func == nil {
+		if t.Cmd.Func == nil && !t.isGroup() {
 			log.Warnw("Task ignored", "task", task, "reason", "func is nil")
 			continue
 		}
 
-		// Before execute command func, we must render each param template
-		// if it exists with  Value registry
-		err = job.RenderTaskTemplate(t)
+		res, err := job.execTask(ctx, t, true)
 		if err != nil {
-			log.Errorw("Task failed to template variables", "task", t.Name, "err", err)
 			return err
 		}
 
-		res := t.Cmd.Func(t.Params)
-		job.Result[t.Name] = res
-
 		if res.Error != nil {
-			log.Errorw("Task result", "task", t.Name, "err", res.Error)
 			return res.Error
 		}
-
-		// In all cases, add task result to value registry
-		log.Infow("Task result", "task", t.Name, "result", res.Result)
 	}
 
 	return nil
@@ -158,50 +300,68 @@ func (job *Job) RunTaskByTask(tasks string) error {
 //
 // If a task returns success, check and continue with task's OnSuccess
 // if specified or next task in order.
-func (job *Job) RunAllTasks(task *Task) error {
+func (job *Job) RunAllTasks(ctx context.Context, task *Task) error {
 	log.Infow("Task running", "task", task.Name)
 
-	if task.Cmd.Func == nil {
+	// Stop the flow when the job has timed out
+	if ctx.Err() != nil {
+		err := job.timeoutError(task.Name)
+		log.Errorw("Task not started", "task", task.Name, "err", err)
+		return err
+	}
+
+	if task.Cmd.Func == nil && !task.isGroup() {
 		log.Warnw("Task ignored", "task", task.Name, "reason", "func is nil")
 		return nil
 	}
 
-	// Before execute command func, we must render each param template
-	// if it exists with  Value registry
-	err := job.RenderTaskTemplate(task)
+	res, err := job.execTask(ctx, task, true)
 	if err != nil {
-		log.Errorw("Task faild to template variables", "task", task.Name, "err", err)
 		return err
 	}
 
-	res := task.Cmd.Func(task.Params)
-	job.Result[task.Name] = res
-
 	if res.Error != nil {
-		log.Errorw("Task result", "task", task.Name, "err", res.Error)
-
 		// Go the task of failure if specified
 		if len(task.OnFailure) > 0 {
 			taskFailure, _ := job.GetTaskByName(task.OnFailure)
-			return job.RunAllTasks(taskFailure)
+			return job.RunAllTasks(ctx, taskFailure)
 		}
 
 		// otherwise, return error
 		return res.Error
 	}
 
-	// In all cases, add task result to value registry
-	log.Infow("Task result", "task", task.Name, "result", res.Result)
-
 	// Go the task of Success if specified
 	if len(task.OnSuccess) > 0 {
 		taskSuccess, _ := job.GetTaskByName(task.OnSuccess)
-		return job.RunAllTasks(taskSuccess)
+		return job.RunAllTasks(ctx, taskSuccess)
 	}
 
 	return nil
 }
 
+// AllTasks returns all tasks of the job in their declaration order,
+// including the tasks of groups and the job always tasks
+func (job *Job) AllTasks() []*Task {
+	all := []*Task{}
+
+	var walk func(tasks []*Task)
+	walk = func(tasks []*Task) {
+		for _, task := range tasks {
+			all = append(all, task)
+
+			walk(task.Block)
+			walk(task.Rescue)
+			walk(task.Always)
+		}
+	}
+
+	walk(job.Tasks)
+	walk(job.Always)
+
+	return all
+}
+
 // GetTaskByName returns task by its name in the task list of the job
 func (job *Job) GetTaskByName(name string) (*Task, error) {
 	for _, task := range job.Tasks {
@@ -233,8 +393,16 @@ func (job *Job) CheckTasks() error {
 	}
 
 	// Loop again all tasks and check for each task, the name specified
-	// in Task On Success or Task On Failure exists in the list of task names
+	// in Task On Success or Task On Failure or in its dependencies
+	// exists in the list of task names
 	for _, task := range job.Tasks {
+		for _, dep := range task.DependsOn {
+			res = utils.ArrayIsElementIn(dep, taskNames, fn)
+			if res == false {
+				err := fmt.Errorf("task %s does not exist", dep)
+				return err
+			}
+		}
 		if task.OnSuccess != "" {
 			res = utils.ArrayIsElementIn(task.OnSuccess, taskNames, fn)
 			if res == false {
@@ -251,68 +419,474 @@ func (job *Job) CheckTasks() error {
 		}
 	}
 
-	return nil
+	// Jobs with dependencies are executed as a graph
+	// in which OnSuccess and OnFailure have no meaning
+	if job.hasDependencies() {
+		for _, task := range job.Tasks {
+			if task.OnSuccess != "" || task.OnFailure != "" {
+				return fmt.Errorf("task %s: on_success and on_failure cannot be used in a job with depends_on", task.Name)
+			}
+		}
+	}
+
+	// Tasks of groups must have unique names
+	err := job.checkNestedTasks()
+	if err != nil {
+		return err
+	}
+
+	// Dependencies must not contain any cycle
+	return job.checkDependencyCycles()
 }
 
 // RenderTaskTemplate renders go template in each param with
-// the values in Job Context & Result
-func (job *Job) RenderTaskTemplate(task *Task) error {
-	var tpl bytes.Buffer
+// the values in Job Context & Result, and the extra data given.
+//
+// Params are rendered recursively through maps and lists. A param
+// made of a unique action keeps the type of its bool or number value,
+// and the template functions native, fromYaml and fromJson return
+// values with their type such as lists or maps. Defaults of the
+// command params are added for the params not specified.
+//
+// It returns the rendered params. Task params are not modified
+// so that the task can be rendered several times.
+func (job *Job) RenderTaskTemplate(task *Task, extra map[string]interface{}) (map[string]interface{}, error) {
+	params := make(map[string]interface{}, len(task.Params))
+
+	d := job.templateData(task)
+	for k, v := range extra {
+		d[k] = v
+	}
 
-	// Combine Job Context & Result into one map to render template
-	data := make(map[string]interface{})
-	data["context"] = job.Context
-	data["result"] = job.Result
+	for key, value := range task.Params {
+		v, err := renderValue(task.Name, key, value, d)
+		if err != nil {
+			return nil, err
+		}
 
-	// Expand env vars for context
-	d := expandEnvContext(data)
+		params[key] = v
+	}
 
-	for key, value := range task.Params {
-		tpl.Reset()
+	return applyParamDefaults(params, task.Cmd.Params), nil
+}
 
-		kind := reflect.ValueOf(value).Kind()
-		// Render only string value
-		// Check if kind is struct or ptr, do nothing
-		if kind == reflect.Array || kind == reflect.Slice {
-			arr := []string{}
+//////////////// INTERNAL FUNCTIONS ////////////////////
 
-			for idx, it := range cast.ToStringSlice(value) {
-				str, err := renderParamTemplate(task.Name, key+"["+cast.ToString(idx)+"]", it, d)
-				if err != nil {
-					return err
-				}
+// run executes the tasks of the job and its always tasks
+func (job *Job) run(tasks string) error {
+	var err error
 
-				arr = append(arr, str)
-			}
+	ctx := context.Background()
+	if job.Timeout > 0 {
+		var cancel context.CancelFunc
 
-			task.Params[key] = arr
-		} else if kind == reflect.Map || kind == reflect.Struct || kind == reflect.Ptr {
-			log.Warnw("Param kind ignored", "kind", kind)
-		} else {
-			str, err := renderParamTemplate(task.Name, key, value, d)
+		ctx, cancel = context.WithTimeout(ctx, job.Timeout)
+		defer cancel()
+	}
+
+	log.Infow("JOB RUN STARTED", "job", job.Name, "hosts", job.Hosts)
+	log.Debugw("Job context", "context", job.Context)
+
+	// Check the name of all tasks indicated in taskflow
+	err = job.CheckTasks()
+	if err != nil {
+		job.Status = FAILED
+		log.Errorw(err.Error())
+		return err
+	}
+
+	// Run certain tasks given in parameter
+	if tasks != "" {
+		err = job.RunTaskByTask(ctx, tasks)
+	} else if job.hasDependencies() {
+		// Run tasks as a graph following their dependencies
+		err = job.RunDAG(ctx)
+	} else {
+		// Run complete taskflow by running the first task
+		err = job.RunAllTasks(ctx, job.Start)
+	}
+
+	// Cleanup failures are reported separately
+	job.CleanupErr = job.runAlways()
+
+	if err != nil {
+		job.Status = FAILED
+		log.Errorw("JOB RUN FAILED", "job", job.Name)
+		return err
+	}
+
+	log.Debugw("Job result", "result", job.Result)
+	log.Infow("JOB RUN COMPLETED", "job", job.Name, "hosts", job.Hosts)
+
+	return nil
+}
+
+// execTask renders the task params and executes the task
+// if its when condition is true.
+//
+// It returns an error only if the task could not be executed.
+// The error of the command is in its result.
+//
+// If resume is set, a task succeeded in the previous run of the job
+// is restored instead of being executed. Always tasks are not
+// resumed so that cleanup is executed on each run.
+func (job *Job) execTask(ctx context.Context, task *Task, resume bool) (*CmdResult, error) {
+	// Tasks succeeded in a previous run are not executed again
+	if resume {
+		if res := job.resumedResult(task.Name); res != nil {
+			return job.restoreTask(task, res), nil
+		}
+	}
+
+	// Check the condition to know if task must be executed
+	if task.When != "" {
+		ok, err := renderCondition(task.Name, "when", task.When, job.templateData(task))
+		if err != nil {
+			log.Errorw("Task failed to evaluate condition", "task", task.Name, "err", err)
+			job.failTask(task, err, time.Time{})
+			return nil, err
+		}
+
+		if !ok {
+			return job.skipTask(task, "when condition is false"), nil
+		}
+	}
+
+	// Commands not supporting check mode would perform their actions
+	if job.Check && !task.isGroup() && !task.Cmd.SupportsCheck {
+		return job.skipTask(task, "check mode not supported by command"), nil
+	}
+
+	var res *CmdResult
+
+	start := time.Now()
+	job.notify(&TaskStarted{Job: job, Task: task, Host: job.Hosts, Time: start})
+
+	if task.isGroup() {
+		// Execute block, rescue and always tasks
+		res = job.runGroup(ctx, task, resume)
+	} else if task.Loop != nil {
+		// Execute the command for each item of the loop
+		loopRes, err := job.runLoop(ctx, task)
+		if err != nil {
+			log.Errorw("Task failed to loop over items", "task", task.Name, "err", err)
+			job.failTask(task, err, start)
+			return nil, err
+		}
+
+		res = loopRes
+	} else {
+		// Before execute command func, we must render each param template
+		// if it exists with  Value registry
+		params, err := job.RenderTaskTemplate(task, nil)
+		if err != nil {
+			log.Errorw("Task failed to template variables", "task", task.Name, "err", err)
+			job.failTask(task, err, start)
+			return nil, err
+		}
+
+		res = job.runTask(ctx, task, params)
+	}
+
+	res.Duration = time.Since(start)
+	job.recordResult(task, res)
+	job.printPlanned(task, res)
+
+	if res.Error != nil {
+		log.Errorw("Task result", "task", task.Name, "err", res.Error)
+		return res, nil
+	}
+
+	// In all cases, add task result to value registry
+	log.Infow("Task result", "task", task.Name, "result", res.Result)
+
+	return res, nil
+}
+
+// recordResult stores the task result and sends the event
+// of the task finished.
+//
+// Facts returned by the command and the registered result
+// are added to the job context for next tasks.
+func (job *Job) recordResult(task *Task, res *CmdResult) {
+	job.setResult(task.Name, res)
+
+	if res.Error == nil && len(res.Facts) > 0 {
+		job.setFacts(res.Facts)
+	}
+
+	if task.Register != "" {
+		job.setFacts(map[string]interface{}{task.Register: res.Result})
+	}
+
+	job.finishTask(task, res)
+}
+
+// runTask executes the task command with the params given and retries
+// it as long as it fails or its until condition is not met, within
+// the limit of task retries. The last attempt result is returned
+// with the status, error and duration of all attempts.
+func (job *Job) runTask(ctx context.Context, task *Task, params map[string]interface{}) *CmdResult {
+	attempts := []Attempt{}
+
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+
+		res := job.execTaskCmd(ctx, task, params)
+		res.Attempts = attempt
+		res.Status = FAILED
+
+		// Record the attempt once its status is known
+		record := func() {
+			attempts = append(attempts, Attempt{Status: res.Status, Error: res.Error, Duration: time.Since(start)})
+			res.AttemptResults = attempts
+		}
+
+		if res.Error == nil && task.Until != "" {
+			data := job.templateData(task)
+			data["current"] = res
+
+			ok, err := renderCondition(task.Name, "until", task.Until, data)
 			if err != nil {
-				return err
+				// No need to retry if condition cannot be rendered
+				res.Error = err
+				record()
+				return res
 			}
 
-			task.Params[key] = str
+			if !ok {
+				res.Error = fmt.Errorf("until condition not met after %d attempt(s): %s", attempt, task.Until)
+			}
+		}
+
+		if res.Error == nil {
+			res.Status = SUCCESS
+			record()
+			return res
+		}
+
+		record()
+
+		if attempt > task.Retries || ctx.Err() != nil {
+			return res
+		}
+
+		delay := task.retryDelay(attempt)
+		log.Warnw("Task attempt failed", "task", task.Name, "attempt", attempt, "retries", task.Retries, "delay", delay, "err", res.Error)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return res
 		}
 	}
+}
 
-	return nil
+// setResult stores the result of a task in the job result
+func (job *Job) setResult(task string, res *CmdResult) {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+
+	job.Result[task] = res
 }
 
-//////////////// INTERNAL FUNCTIONS ////////////////////
+// results returns a copy of the job result which can be
+// read while tasks are running
+func (job *Job) results() map[string]*CmdResult {
+	job.mutex.RLock()
+	defer job.mutex.RUnlock()
+
+	results := make(map[string]*CmdResult, len(job.Result))
+	for k, v := range job.Result {
+		results[k] = v
+	}
+
+	return results
+}
+
+// retryDelay returns the duration to wait before the given retry.
+//
+// With exponential backoff, the delay is doubled at each retry and
+// a random jitter is applied: the half of the delay is kept and a random
+// value between 0 and the other half is added.
+func (task *Task) retryDelay(retry int) time.Duration {
+	if task.Backoff != BackoffExponential || task.Delay <= 0 {
+		return task.Delay
+	}
+
+	delay := task.Delay
+	for i := 1; i < retry && delay < math.MaxInt64/2; i++ {
+		delay *= 2
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// setFacts adds facts to the job context
+func (job *Job) setFacts(facts map[string]interface{}) {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+
+	f, ok := job.Context["facts"].(map[string]interface{})
+	if !ok {
+		f = make(map[string]interface{})
+		job.Context["facts"] = f
+	}
+
+	for k, v := range facts {
+		f[k] = normalizeValue(v)
+		log.Debugw("Fact set", "job", job.Name, "fact", k)
+	}
+}
+
+// getFacts returns a copy of the facts of the job context
+func (job *Job) getFacts() map[string]interface{} {
+	job.mutex.RLock()
+	defer job.mutex.RUnlock()
+
+	facts := make(map[string]interface{})
+	if f, ok := job.Context["facts"].(map[string]interface{}); ok {
+		for k, v := range f {
+			facts[k] = v
+		}
+	}
+
+	return facts
+}
+
+// templateData combines Job Context & Result into one map
+// to render templates. Env vars are expanded in the context
+// except in facts which are computed values. Variables of the
+// context are overridden by the vars of the task given.
+func (job *Job) templateData(task *Task) map[string]interface{} {
+	job.mutex.RLock()
+	context := make(map[string]interface{}, len(job.Context))
+	for k, v := range job.Context {
+		if k != "facts" {
+			context[k] = v
+		}
+	}
+	job.mutex.RUnlock()
+
+	if task != nil && len(task.Vars) > 0 {
+		context["variables"] = job.taskVariables(task, cast.ToStringMap(context["variables"]))
+	}
+
+	context = expandEnvContext(context)
+	context["facts"] = job.getFacts()
+
+	data := make(map[string]interface{})
+	data["context"] = context
+	data["result"] = job.results()
+
+	// Host data are copied so that a task cannot modify them for the others
+	data["host"] = normalizeMap(job.Host)
+	data["hostvars"] = normalizeMap(job.HostVars)
+
+	return data
+}
+
+// renderCondition renders a template condition and
+// interprets the output as a boolean.
+//
+// An empty output or "<no value>" is false.
+func renderCondition(task, key, cond string, data map[string]interface{}) (bool, error) {
+	str, err := renderParamTemplate(task, key, cond, data)
+	if err != nil {
+		return false, err
+	}
+
+	str = strings.ToLower(strings.TrimSpace(str))
+	switch str {
+	case "", "<no value>", "false", "no", "0":
+		return false, nil
+	case "true", "yes", "1":
+		return true, nil
+	}
+
+	return false, fmt.Errorf("task %s: %s condition is not a boolean: %s", task, key, str)
+}
+
+// execTaskCmd executes the command function of the task with
+// a context cancelled when the task timeout expires.
+//
+// The command is run in a goroutine so that a command which does
+// not honor the context cannot block the job after its timeout.
+func (job *Job) execTaskCmd(ctx context.Context, task *Task, params map[string]interface{}) *CmdResult {
+	taskCtx := ctx
+	if task.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		taskCtx, cancel = context.WithTimeout(ctx, task.Timeout)
+		defer cancel()
+	}
+
+	// Give the command an output streamed line by line
+	out := job.newTaskOutput(task)
+	taskCtx = context.WithValue(taskCtx, cmdOutputKey{}, out)
+
+	if job.Check {
+		taskCtx = context.WithValue(taskCtx, checkModeKey{}, true)
+	}
+
+	ch := make(chan *CmdResult, 1)
+	go func() {
+		res := task.Cmd.Func(taskCtx, params)
+		out.flush()
+		ch <- res
+	}()
+
+	var res *CmdResult
+
+	select {
+	case res = <-ch:
+		if res == nil {
+			res = NewCmdResult()
+		}
+	case <-taskCtx.Done():
+		res = NewCmdResult()
+	}
+
+	// Replace the error returned by the command by a timeout error
+	// so that it can be distinguished from the others
+	if ctx.Err() == context.DeadlineExceeded {
+		res.Error = job.timeoutError(task.Name)
+	} else if taskCtx.Err() == context.DeadlineExceeded {
+		res.Error = &TimeoutError{Task: task.Name, Timeout: task.Timeout}
+	} else if taskCtx.Err() != nil && res.Error == nil {
+		res.Error = taskCtx.Err()
+	}
+
+	return res
+}
+
+// timeoutError returns the error for a task which could not
+// be started because the job has timed out
+func (job *Job) timeoutError(task string) error {
+	return &TimeoutError{Task: task, Timeout: job.Timeout}
+}
 
 func renderParamTemplate(task, key string, value interface{}, data map[string]interface{}) (string, error) {
 	var tpl bytes.Buffer
 
-	// Create a new template with name : task name + key
-	log.Debugw("Parameter Templating", "task", task, "value", value.(string), "type", reflect.TypeOf(value).Name())
-	t := template.New(task + "-" + key).Funcs(sprig.TxtFuncMap())
-
 	// Expand env vars before template rendering
 	v := cast.ToString(value)
 	v = os.ExpandEnv(v)
+
+	// Values of params with a secret name are masked in logs.
+	// Templates are not secret, only their rendered values.
+	// Values which are not strings, such as booleans, are not secret
+	_, isString := value.(string)
+	secret := isString && IsSecretName(key)
+	if secret && !strings.Contains(v, "{{") {
+		addNamedSecret(v)
+	}
+
+	// Create a new template with name : task name + key
+	log.Debugw("Parameter Templating", "task", task, "value", value, "type", reflect.TypeOf(value).Name())
+	t := template.New(task + "-" + key).Funcs(templateFuncs())
+
 	t, err := t.Parse(cast.ToString(v))
 	if err != nil {
 		log.Errorw("Parameter template parsing error", "task", task, "key", key)
@@ -325,12 +899,51 @@ func renderParamTemplate(task, key string, value interface{}, data map[string]in
 		return "", err
 	}
 
+	if secret {
+		addNamedSecret(tpl.String())
+	}
+
 	// Assign new rendered value to param key
 	log.Debugw("Parameter's new value rendered", "task", task, "key", key, "tpl", tpl.String())
 
 	return tpl.String(), nil
 }
 
+// normalizeMap converts recursively all maps with interface keys,
+// such as the ones unmarshalled from YAML, into maps with string keys
+func normalizeMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+
+	res := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		res[k] = normalizeValue(v)
+	}
+
+	return res
+}
+
+// normalizeValue converts recursively maps with interface keys
+// contained in the value into maps with string keys
+func normalizeValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[interface{}]interface{}:
+		return normalizeMap(cast.ToStringMap(value))
+	case map[string]interface{}:
+		return normalizeMap(value)
+	case []interface{}:
+		arr := make([]interface{}, len(value))
+		for i, it := range value {
+			arr[i] = normalizeValue(it)
+		}
+
+		return arr
+	}
+
+	return v
+}
+
 //expandEnvContext expands values of env variables
 func expandEnvContext(data map[string]interface{}) map[string]interface{} {
 	d := make(map[string]interface{})
@@ -1,11 +1,14 @@
 package job
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	//"fmt"
 	"os"
 	//"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/yaml.v2"
@@ -17,30 +20,29 @@ func TestCheckTasksSuccess(t *testing.T) {
 
 	task1 := Task{
 		Name: "Task 1",
-		Func: func(m map[string]interface{}) *CmdResult {
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
 			return &CmdResult{Error: nil, Result: nil}
-		},
+		}},
 		OnFailure: "Exit Error",
 		OnSuccess: "Task 2",
 	}
 	task2 := Task{
 		Name: "Task 2",
-		Func: func(m map[string]interface{}) *CmdResult {
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
 			return &CmdResult{Error: nil, Result: nil}
-		},
+		}},
 		OnFailure: "Exit Error",
 		OnSuccess: "Task 3",
 	}
 	task3 := Task{
 		Name: "Task 3",
-		Func: func(m map[string]interface{}) *CmdResult {
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
 			return &CmdResult{Error: nil, Result: nil}
-		},
+		}},
 	}
 
 	taskErr := Task{
 		Name: "Exit Error",
-		Func: nil,
 	}
 
 	w := NewJob("Job 1")
@@ -51,7 +53,7 @@ func TestCheckTasksSuccess(t *testing.T) {
 	w.AddTask(&taskErr)
 
 	res := w.CheckTasks()
-	if res != true {
+	if res != nil {
 		t.Fail()
 	}
 }
@@ -60,30 +62,29 @@ func TestCheckTasksOnFailure(t *testing.T) {
 
 	task1 := Task{
 		Name: "Task 1",
-		Func: func(m map[string]interface{}) *CmdResult {
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
 			return &CmdResult{Error: nil, Result: nil}
-		},
+		}},
 		OnFailure: "Exit Error",
 		OnSuccess: "Task 2",
 	}
 	task2 := Task{
 		Name: "Task 2",
-		Func: func(m map[string]interface{}) *CmdResult {
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
 			return &CmdResult{Error: nil, Result: nil}
-		},
+		}},
 		OnFailure: "Hmmmmmmm",
 		OnSuccess: "Task 3",
 	}
 	task3 := Task{
 		Name: "Task 3",
-		Func: func(m map[string]interface{}) *CmdResult {
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
 			return &CmdResult{Error: nil, Result: nil}
-		},
+		}},
 	}
 
 	taskErr := Task{
 		Name: "Exit Error",
-		Func: nil,
 	}
 
 	w := NewJob("Job 2")
@@ -94,7 +95,7 @@ func TestCheckTasksOnFailure(t *testing.T) {
 	w.AddTask(&taskErr)
 
 	res := w.CheckTasks()
-	if res == true {
+	if res == nil {
 		t.Fail()
 	}
 }
@@ -103,30 +104,29 @@ func TestCheckTasksOnSuccess(t *testing.T) {
 
 	task1 := Task{
 		Name: "Task 1",
-		Func: func(m map[string]interface{}) *CmdResult {
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
 			return &CmdResult{Error: nil, Result: nil}
-		},
+		}},
 		OnFailure: "Exit Error",
 		OnSuccess: "Task 2",
 	}
 	task2 := Task{
 		Name: "Task 2",
-		Func: func(m map[string]interface{}) *CmdResult {
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
 			return &CmdResult{Error: nil, Result: nil}
-		},
+		}},
 		OnFailure: "Exit Error",
 		OnSuccess: "Task 4",
 	}
 	task3 := Task{
 		Name: "Task 3",
-		Func: func(m map[string]interface{}) *CmdResult {
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
 			return &CmdResult{Error: nil, Result: nil}
-		},
+		}},
 	}
 
 	taskErr := Task{
 		Name: "Exit Error",
-		Func: nil,
 	}
 
 	w := NewJob("Job 3")
@@ -137,7 +137,7 @@ func TestCheckTasksOnSuccess(t *testing.T) {
 	w.AddTask(&taskErr)
 
 	res := w.CheckTasks()
-	if res == true {
+	if res == nil {
 		t.Fail()
 	}
 }
@@ -149,10 +149,10 @@ func TestOneTaskJob(t *testing.T) {
 
 	task := Task{
 		Name: "Task 1",
-		Func: func(m map[string]interface{}) *CmdResult {
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
 			testVar = true
 			return &CmdResult{Error: nil, Result: nil}
-		},
+		}},
 	}
 
 	w := NewJob("Job 4")
@@ -176,58 +176,58 @@ func TestMultipleTasks(t *testing.T) {
 
 	task1 := Task{
 		Name: "Task1",
-		Func: func(m map[string]interface{}) *CmdResult {
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
 			return &CmdResult{Error: nil, Result: nil}
-		},
+		}},
 		OnFailure: "Error",
 		OnSuccess: "Task2",
 	}
 	task3 := Task{
 		Name: "Task3",
-		Func: func(m map[string]interface{}) *CmdResult {
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
 			return &CmdResult{Error: errors.New("Task3: NOK"), Result: nil}
-		},
+		}},
 		OnFailure: "Rollback1",
 		OnSuccess: "Task4",
 	}
 	task2 := Task{
 		Name: "Task2",
-		Func: func(m map[string]interface{}) *CmdResult {
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
 			return &CmdResult{Error: nil, Result: nil}
-		},
+		}},
 		OnSuccess: "Task3",
 		OnFailure: "Error",
 	}
 	task4 := Task{
 		Name: "Task4",
-		Func: func(m map[string]interface{}) *CmdResult {
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
 			return &CmdResult{Error: nil, Result: nil}
-		},
+		}},
 		OnFailure: "Error",
 	}
 
 	rollback1 := Task{
 		Name: "Rollback1",
-		Func: func(m map[string]interface{}) *CmdResult {
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
 			return &CmdResult{Error: nil, Result: nil}
-		},
+		}},
 		OnFailure: "Error",
 		OnSuccess: "Rollback2",
 	}
 
 	rollback2 := Task{
 		Name: "Rollback2",
-		Func: func(m map[string]interface{}) *CmdResult {
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
 			return &CmdResult{Error: nil, Result: nil}
-		},
+		}},
 		OnFailure: "Error",
 	}
 
 	err := Task{
 		Name: "Error",
-		Func: func(m map[string]interface{}) *CmdResult {
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
 			return &CmdResult{Error: nil, Result: nil}
-		},
+		}},
 	}
 
 	w := NewJob("Job 5")
@@ -333,9 +333,9 @@ var4:
 
 	task1 := Task{
 		Name: "Task 1",
-		Func: func(m map[string]interface{}) *CmdResult {
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
 			return &CmdResult{Error: nil, Result: m}
-		},
+		}},
 		Params: map[string]interface{}{
 			"param1": "$VAR1 {{ .context.variables.var1 }}",
 			"param2": []string{"$VAR21", "{{ index .context.variables.var2 1 }}", "3"},
@@ -353,5 +353,306 @@ var4:
 	// Check result of task1
 	result, ok := w.Result["Task 1"]
 	assert.Equal(t, true, ok)
-	assert.Equal(t, result, output)
+	assert.Equal(t, output, result.Result)
+}
+
+func TestRenderTaskTemplateTyped(t *testing.T) {
+	w := NewJob("Job 11")
+	w.Context["variables"] = map[string]interface{}{
+		"draft":   true,
+		"count":   3,
+		"ratio":   0.5,
+		"version": "1.0",
+		"zip":     "007",
+		"assets":  []interface{}{"a.zip", "b.zip"},
+		"yaml":    "name: app\nports: [80, 443]",
+		"json":    `{"enabled": true}`,
+	}
+
+	task := &Task{
+		Name: "Task 1",
+		Params: map[string]interface{}{
+			"draft":   "{{ .context.variables.draft }}",
+			"message": "draft: {{ .context.variables.draft }}",
+			"count":   "{{ .context.variables.count }}",
+			"ratio":   "{{ .context.variables.ratio }}",
+			"version": "{{ .context.variables.version }}",
+			"zip":     "{{ .context.variables.zip }}",
+			"literal": "true",
+			"number":  8,
+			"nested": map[interface{}]interface{}{
+				"assets": "{{ native .context.variables.assets }}",
+				"list": []interface{}{
+					"{{ .context.variables.count }}",
+					map[interface{}]interface{}{"name": "{{ .context.variables.version }}"},
+				},
+			},
+			"yaml": "{{ fromYaml .context.variables.yaml }}",
+			"json": "{{ .context.variables.json | fromJson }}",
+		},
+	}
+
+	params, err := w.RenderTaskTemplate(task, nil)
+	assert.Nil(t, err)
+
+	assert.Equal(t, map[string]interface{}{
+		"draft":   true,
+		"message": "draft: true",
+		"count":   3,
+		"ratio":   0.5,
+		"version": "1.0",
+		"zip":     "007",
+		"literal": "true",
+		"number":  8,
+		"nested": map[string]interface{}{
+			"assets": []interface{}{"a.zip", "b.zip"},
+			"list": []interface{}{
+				3,
+				map[string]interface{}{"name": "1.0"},
+			},
+		},
+		"yaml": map[string]interface{}{"name": "app", "ports": []interface{}{80, 443}},
+		"json": map[string]interface{}{"enabled": true},
+	}, params)
+
+	// Native value must be the whole param
+	task.Params = map[string]interface{}{
+		"assets": "assets: {{ native .context.variables.assets }}",
+	}
+
+	_, err = w.RenderTaskTemplate(task, nil)
+	assert.NotNil(t, err)
+}
+
+func TestTaskTimeout(t *testing.T) {
+	var handled bool
+
+	task1 := Task{
+		Name: "Task1",
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
+			<-ctx.Done()
+			return &CmdResult{Error: ctx.Err(), Result: nil}
+		}},
+		Timeout:   50 * time.Millisecond,
+		OnFailure: "Timeout",
+	}
+
+	task2 := Task{
+		Name: "Timeout",
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
+			handled = true
+			return &CmdResult{Error: nil, Result: nil}
+		}},
+	}
+
+	w := NewJob("Job 6")
+	w.Start = &task1
+	w.AddTask(&task1)
+	w.AddTask(&task2)
+
+	err := w.Run("")
+	assert.Nil(t, err)
+	assert.True(t, handled)
+	assert.True(t, IsTimeout(w.Result["Task1"].Error))
+}
+
+func TestJobTimeout(t *testing.T) {
+	task1 := Task{
+		Name: "Task1",
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
+			// Ignore context to ensure job does not block
+			time.Sleep(time.Second)
+			return &CmdResult{Error: nil, Result: nil}
+		}},
+	}
+
+	w := NewJob("Job 7")
+	w.Timeout = 50 * time.Millisecond
+	w.Start = &task1
+	w.AddTask(&task1)
+
+	err := w.Run("")
+	assert.True(t, IsTimeout(err))
+	assert.Equal(t, FAILED, w.Status)
+}
+
+func TestTaskRetries(t *testing.T) {
+	testCases := []struct {
+		name     string
+		retries  int
+		until    string
+		attempts int
+		err      bool
+	}{
+		{"SuccessAfterRetries", 3, "", 3, false},
+		{"RetriesExhausted", 1, "", 2, true},
+		{"UntilConditionMet", 5, "{{ ge .current.Result.count 4 }}", 4, false},
+		{"UntilConditionNotMet", 1, "{{ ge .current.Result.count 4 }}", 2, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			count := 0
+
+			task := Task{
+				Name: "Task1",
+				Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
+					count++
+					// Fail twice before succeeding
+					if tc.until == "" && count < 3 {
+						return &CmdResult{Error: errors.New("Task1: NOK"), Result: nil}
+					}
+					return &CmdResult{Error: nil, Result: map[string]interface{}{"count": count}}
+				}},
+				Retries: tc.retries,
+				Delay:   time.Millisecond,
+				Until:   tc.until,
+			}
+
+			w := NewJob("Job 8")
+			w.Start = &task
+			w.AddTask(&task)
+
+			err := w.Run("")
+			assert.Equal(t, tc.err, err != nil)
+			assert.Equal(t, tc.attempts, w.Result["Task1"].Attempts)
+
+			// Each attempt is recorded, only the last one can succeed
+			attempts := w.Result["Task1"].AttemptResults
+			assert.Len(t, attempts, tc.attempts)
+			for i, a := range attempts[:len(attempts)-1] {
+				assert.Equal(t, FAILED, a.Status, i)
+				assert.NotNil(t, a.Error, i)
+			}
+
+			last := attempts[len(attempts)-1]
+			assert.Equal(t, tc.err, last.Status == FAILED)
+			assert.Equal(t, tc.err, last.Error != nil)
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	task := Task{Delay: time.Second}
+	assert.Equal(t, time.Second, task.retryDelay(3))
+
+	task.Backoff = BackoffExponential
+	for retry, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		delay := task.retryDelay(retry + 1)
+		assert.True(t, delay >= max/2 && delay <= max, "retry %d: %s", retry+1, delay)
+	}
+}
+
+func TestTaskWhen(t *testing.T) {
+	executed := map[string]bool{}
+
+	fn := func(name string) CmdFunc {
+		return func(ctx context.Context, m map[string]interface{}) *CmdResult {
+			executed[name] = true
+			return &CmdResult{Error: nil, Result: map[string]interface{}{"deploy": name == "Task1"}}
+		}
+	}
+
+	task1 := Task{
+		Name:      "Task1",
+		Cmd:       Cmd{Func: fn("Task1")},
+		OnSuccess: "Task2",
+	}
+	task2 := Task{
+		Name:      "Task2",
+		Cmd:       Cmd{Func: fn("Task2")},
+		When:      "{{ .context.variables.release }}",
+		OnSuccess: "Task3",
+	}
+	task3 := Task{
+		Name: "Task3",
+		Cmd:  Cmd{Func: fn("Task3")},
+		When: "{{ .result.Task1.Result.deploy }}",
+	}
+
+	w := NewJob("Job 9")
+	w.Context["variables"] = map[string]interface{}{"release": false}
+	w.Start = &task1
+	w.AddTask(&task1)
+	w.AddTask(&task2)
+	w.AddTask(&task3)
+
+	err := w.Run("")
+	assert.Nil(t, err)
+
+	assert.Equal(t, map[string]bool{"Task1": true, "Task3": true}, executed)
+	assert.Equal(t, SUCCESS, w.Result["Task1"].Status)
+	assert.Equal(t, SKIPPED, w.Result["Task2"].Status)
+	assert.Equal(t, SUCCESS, w.Result["Task3"].Status)
+}
+
+func TestTaskRegisterAndFacts(t *testing.T) {
+	var received []interface{}
+
+	task1 := Task{
+		Name: "Task1",
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
+			return &CmdResult{
+				Error:  nil,
+				Result: map[string]interface{}{"version": "1.0.0"},
+				Facts:  map[string]interface{}{"env": map[interface{}]interface{}{"name": "prod"}},
+			}
+		}},
+		Register:  "build",
+		OnSuccess: "Task2",
+	}
+	task2 := Task{
+		Name: "Task2",
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
+			received = append(received, m["version"], m["env"])
+			return &CmdResult{Error: nil, Result: map[string]interface{}{}}
+		}},
+		Params: map[string]interface{}{
+			"version": "{{ .context.facts.build.version }}",
+			"env":     "{{ .context.facts.env.name }}",
+		},
+	}
+
+	w := NewJob("Job 10")
+	w.Start = &task1
+	w.AddTask(&task1)
+	w.AddTask(&task2)
+
+	err := w.Run("")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"1.0.0", "prod"}, received)
+
+	facts := w.getFacts()
+	assert.Equal(t, map[string]interface{}{"version": "1.0.0"}, facts["build"])
+	assert.Equal(t, map[string]interface{}{"name": "prod"}, facts["env"])
+}
+
+func TestCmdResultJSON(t *testing.T) {
+	res := &CmdResult{
+		Error:    errors.New("NOK"),
+		Result:   map[string]interface{}{"list": []interface{}{map[interface{}]interface{}{"a": 1}}},
+		Attempts: 2,
+		AttemptResults: []Attempt{
+			{Status: FAILED, Error: errors.New("NOK"), Duration: time.Second},
+			{Status: FAILED, Error: errors.New("NOK again"), Duration: time.Second},
+		},
+		Status: FAILED,
+		Facts:  map[string]interface{}{"fact": "value"},
+	}
+
+	b, err := json.Marshal(res)
+	assert.Nil(t, err)
+
+	actual := &CmdResult{}
+	err = json.Unmarshal(b, actual)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "NOK", actual.Error.Error())
+	assert.Equal(t, []interface{}{map[string]interface{}{"a": float64(1)}}, actual.Result["list"])
+	assert.Equal(t, 2, actual.Attempts)
+	assert.Len(t, actual.AttemptResults, 2)
+	assert.Equal(t, "NOK again", actual.AttemptResults[1].Error.Error())
+	assert.Equal(t, time.Second, actual.AttemptResults[1].Duration)
+	assert.Equal(t, FAILED, actual.Status)
+	assert.Equal(t, map[string]interface{}{"fact": "value"}, actual.Facts)
 }
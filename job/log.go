@@ -0,0 +1,86 @@
+package job
+
+import (
+	"fmt"
+
+	golog "github.com/uthng/golog"
+)
+
+/////////// DECLARATION OF ALL TYPES //////////////////////////
+
+// maskedLogger logs with golog after masking the secret
+// values in the message and in the values of key/value pairs
+type maskedLogger struct {
+	debugw func(msg string, kv ...interface{})
+	infow  func(msg string, kv ...interface{})
+	warnw  func(msg string, kv ...interface{})
+	errorw func(msg string, kv ...interface{})
+}
+
+///////// DECLARATION OF ALL GLOBAL VARIABLES ///////////
+
+// log is the logger of the package. All logs of the package
+// go through it so that no secret is written in logs
+var log = &maskedLogger{
+	debugw: golog.Debugw,
+	infow:  golog.Infow,
+	warnw:  golog.Warnw,
+	errorw: golog.Errorw,
+}
+
+//////////////// INTERNAL FUNCTIONS ////////////////////
+
+// NewLogger returns a new golog logger masking secrets
+func (l *maskedLogger) NewLogger() *maskedLogger {
+	logger := golog.NewLogger()
+
+	return &maskedLogger{
+		debugw: logger.Debugw,
+		infow:  logger.Infow,
+		warnw:  logger.Warnw,
+		errorw: logger.Errorw,
+	}
+}
+
+func (l *maskedLogger) Debugw(msg string, kv ...interface{}) {
+	l.debugw(MaskSecrets(msg), maskLogValues(kv)...)
+}
+
+func (l *maskedLogger) Infow(msg string, kv ...interface{}) {
+	l.infow(MaskSecrets(msg), maskLogValues(kv)...)
+}
+
+func (l *maskedLogger) Warnw(msg string, kv ...interface{}) {
+	l.warnw(MaskSecrets(msg), maskLogValues(kv)...)
+}
+
+func (l *maskedLogger) Errorw(msg string, kv ...interface{}) {
+	l.errorw(MaskSecrets(msg), maskLogValues(kv)...)
+}
+
+// Debugln, Infoln and Debugf always log with the default golog logger
+func (l *maskedLogger) Debugln(args ...interface{}) {
+	golog.Debugln(maskLogValues(args)...)
+}
+
+func (l *maskedLogger) Infoln(args ...interface{}) {
+	golog.Infoln(maskLogValues(args)...)
+}
+
+func (l *maskedLogger) Debugf(format string, args ...interface{}) {
+	golog.Debugf("%s", MaskSecrets(fmt.Sprintf(format, args...)))
+}
+
+// maskLogValues masks the secrets in all values logged
+func maskLogValues(values []interface{}) []interface{} {
+	if !hasSecrets() {
+		return values
+	}
+
+	res := make([]interface{}, len(values))
+	for i, v := range values {
+		res[i] = maskLogValue(v)
+	}
+
+	return res
+}
@@ -0,0 +1,202 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cast"
+	"gopkg.in/yaml.v2"
+)
+
+////////// DECLARATION OF ALL GLOBAL VARIABLES ///////////
+
+// reSingleAction matches a template made of a unique action
+// such as "{{ .context.variables.hosts }}"
+var reSingleAction = regexp.MustCompile(`^\s*\{\{-?\s*((?s:.*?))\s*-?\}\}\s*$`)
+
+//////////////// INTERNAL FUNCTIONS ////////////////////
+
+// runLoop executes the task command once per loop item and
+// aggregates the results of all iterations in one result.
+//
+// The aggregated result contains the list "results" in which each
+// element has the item, its index, its status, error and result.
+// The aggregated result fails if at least one iteration failed.
+func (job *Job) runLoop(ctx context.Context, task *Task) (*CmdResult, error) {
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	items, err := job.resolveLoopItems(task)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infow("Task looping over items", "task", task.Name, "items", len(items))
+
+	// Render all params before executing any iteration
+	// to fail immediately in case of template error
+	params := make([]map[string]interface{}, len(items))
+	for i, item := range items {
+		params[i], err = job.RenderTaskTemplate(task, map[string]interface{}{"item": item, "index": i})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	parallel := task.LoopParallel
+	if parallel <= 0 {
+		parallel = 1
+	}
+
+	results := make([]*CmdResult, len(items))
+	sem := make(chan struct{}, parallel)
+	stop := false
+
+	for i := range items {
+		sem <- struct{}{}
+
+		mutex.Lock()
+		stopped := stop
+		mutex.Unlock()
+
+		if stopped || ctx.Err() != nil {
+			<-sem
+			break
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			log.Debugw("Task loop item running", "task", task.Name, "index", i, "item", items[i])
+			res := job.runTask(ctx, task, params[i])
+
+			if res.Error != nil {
+				log.Warnw("Task loop item failed", "task", task.Name, "index", i, "item", items[i], "err", res.Error)
+
+				if task.BreakOnError {
+					mutex.Lock()
+					stop = true
+					mutex.Unlock()
+				}
+			}
+
+			results[i] = res
+		}(i)
+	}
+
+	wg.Wait()
+
+	return aggregateLoopResults(items, results), nil
+}
+
+// resolveLoopItems returns the list of items of the task loop.
+//
+// Loop can be a list whose string items are rendered, or a template
+// which must output a list in YAML or JSON. If the template is
+// a unique action, its value is converted to JSON automatically.
+func (job *Job) resolveLoopItems(task *Task) ([]interface{}, error) {
+	data := job.templateData(task)
+
+	str, ok := task.Loop.(string)
+	if !ok {
+		items, err := cast.ToSliceE(task.Loop)
+		if err != nil {
+			return nil, fmt.Errorf("task %s: loop is not a list: %v", task.Name, task.Loop)
+		}
+
+		res := make([]interface{}, len(items))
+		for i, item := range items {
+			if s, ok := item.(string); ok {
+				rendered, err := renderParamTemplate(task.Name, "loop["+cast.ToString(i)+"]", s, data)
+				if err != nil {
+					return nil, err
+				}
+
+				item = rendered
+			}
+
+			res[i] = item
+		}
+
+		return res, nil
+	}
+
+	// Convert the value of the action to JSON to get its native type
+	if m := reSingleAction.FindStringSubmatch(str); m != nil && strings.Count(str, "{{") == 1 {
+		str = "{{ toJson (" + m[1] + ") }}"
+	}
+
+	rendered, err := renderParamTemplate(task.Name, "loop", str, data)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []interface{}{}
+	err = yaml.Unmarshal([]byte(rendered), &items)
+	if err != nil {
+		return nil, fmt.Errorf("task %s: loop does not resolve to a list: %s", task.Name, rendered)
+	}
+
+	return items, nil
+}
+
+// aggregateLoopResults combines the results of all loop iterations.
+// Iterations not executed are marked as skipped.
+func aggregateLoopResults(items []interface{}, results []*CmdResult) *CmdResult {
+	var failed int
+
+	res := NewCmdResult()
+	res.Status = SUCCESS
+
+	list := make([]interface{}, len(items))
+	for i, item := range items {
+		r := results[i]
+		if r == nil {
+			r = &CmdResult{Result: map[string]interface{}{}, Status: SKIPPED}
+		}
+
+		var errStr interface{}
+		if r.Error != nil {
+			errStr = r.Error.Error()
+			failed++
+		}
+
+		list[i] = map[string]interface{}{
+			"item":     item,
+			"index":    i,
+			"status":   r.Status,
+			"error":    errStr,
+			"attempts": r.Attempts,
+			"result":   r.Result,
+		}
+
+		res.Attempts += r.Attempts
+		res.AttemptResults = append(res.AttemptResults, r.AttemptResults...)
+		res.Planned = append(res.Planned, r.Planned...)
+
+		// Merge facts set by successful iterations
+		if r.Error == nil && len(r.Facts) > 0 {
+			if res.Facts == nil {
+				res.Facts = make(map[string]interface{})
+			}
+
+			for k, v := range r.Facts {
+				res.Facts[k] = v
+			}
+		}
+	}
+
+	res.Result["results"] = list
+
+	if failed > 0 {
+		res.Status = FAILED
+		res.Error = fmt.Errorf("%d of %d loop item(s) failed", failed, len(items))
+	}
+
+	return res
+}
@@ -0,0 +1,107 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskLoop(t *testing.T) {
+	testCases := []struct {
+		name         string
+		loop         interface{}
+		parallel     int
+		breakOnError bool
+		executed     []string
+		statuses     []int
+		err          bool
+	}{
+		{
+			"LiteralList",
+			[]interface{}{"a", "{{ .context.variables.second }}", "c"},
+			0,
+			false,
+			[]string{"0-a", "1-b", "2-c"},
+			[]int{SUCCESS, SUCCESS, SUCCESS},
+			false,
+		},
+		{
+			"TemplateList",
+			"{{ .context.variables.hosts }}",
+			2,
+			false,
+			[]string{"0-host1", "1-host2", "2-host3"},
+			[]int{SUCCESS, SUCCESS, SUCCESS},
+			false,
+		},
+		{
+			"ItemFailed",
+			[]interface{}{"a", "fail", "c"},
+			0,
+			false,
+			[]string{"0-a", "1-fail", "2-c"},
+			[]int{SUCCESS, FAILED, SUCCESS},
+			true,
+		},
+		{
+			"BreakOnError",
+			[]interface{}{"a", "fail", "c"},
+			0,
+			true,
+			[]string{"0-a", "1-fail"},
+			[]int{SUCCESS, FAILED, SKIPPED},
+			true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var mutex sync.Mutex
+			executed := []string{}
+
+			task := Task{
+				Name: "Task1",
+				Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
+					mutex.Lock()
+					executed = append(executed, m["param"].(string))
+					mutex.Unlock()
+
+					if m["param"] == "1-fail" {
+						return &CmdResult{Error: errors.New("NOK"), Result: map[string]interface{}{}}
+					}
+					return &CmdResult{Error: nil, Result: map[string]interface{}{"result": m["param"]}}
+				}},
+				Params: map[string]interface{}{
+					"param": "{{ .index }}-{{ .item }}",
+				},
+				Loop:         tc.loop,
+				LoopParallel: tc.parallel,
+				BreakOnError: tc.breakOnError,
+			}
+
+			w := NewJob("Job Loop")
+			w.Context["variables"] = map[string]interface{}{
+				"second": "b",
+				"hosts":  []interface{}{"host1", "host2", "host3"},
+			}
+			w.Start = &task
+			w.AddTask(&task)
+
+			err := w.Run("")
+			assert.Equal(t, tc.err, err != nil)
+			assert.ElementsMatch(t, tc.executed, executed)
+
+			results := w.Result["Task1"].Result["results"].([]interface{})
+			assert.Equal(t, len(tc.statuses), len(results))
+
+			for i, status := range tc.statuses {
+				r := results[i].(map[string]interface{})
+				assert.Equal(t, i, r["index"])
+				assert.Equal(t, status, r["status"])
+			}
+		})
+	}
+}
@@ -5,8 +5,6 @@ import (
 	//"io/ioutil"
 	"path/filepath"
 	"plugin"
-
-	log "github.com/uthng/golog"
 )
 
 ////////// DECLARATION ALL TYPES ////////////////////
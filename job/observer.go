@@ -0,0 +1,168 @@
+package job
+
+import (
+	"time"
+)
+
+/////////// DECLARATION OF ALL TYPES //////////////////////////
+
+// Event is an event of the execution of a flow.
+// Observers use a type switch to get the event attributes.
+type Event interface {
+	// EventName returns the name of the event type
+	EventName() string
+}
+
+// Observer receives the events of flow and job executions.
+//
+// Events are sent synchronously from the goroutines executing
+// jobs and tasks, so observers must be safe for concurrent use
+// and return quickly.
+type Observer interface {
+	OnEvent(e Event)
+}
+
+// ObserverFunc is a function used as an observer
+type ObserverFunc func(e Event)
+
+// FlowStarted is sent when the flow starts executing jobs
+type FlowStarted struct {
+	Flow *Flow
+	Time time.Time
+}
+
+// FlowFinished is sent when all jobs of the flow are finished
+type FlowFinished struct {
+	Flow     *Flow
+	Time     time.Time
+	Status   int
+	Error    error
+	Duration time.Duration
+}
+
+// JobStarted is sent when a job starts on a host
+type JobStarted struct {
+	Job  *Job
+	Host string
+	Time time.Time
+}
+
+// JobFinished is sent when a job is finished on a host
+type JobFinished struct {
+	Job      *Job
+	Host     string
+	Time     time.Time
+	Status   int
+	Error    error
+	Duration time.Duration
+}
+
+// TaskStarted is sent when a task starts
+type TaskStarted struct {
+	Job  *Job
+	Task *Task
+	Host string
+	Time time.Time
+}
+
+// TaskFinished is sent when a task is finished, skipped
+// or could not be executed
+type TaskFinished struct {
+	Job      *Job
+	Task     *Task
+	Host     string
+	Time     time.Time
+	Result   *CmdResult
+	Duration time.Duration
+}
+
+// HostUnreachable is sent when the connection to
+// the host of a job fails
+type HostUnreachable struct {
+	Job   *Job
+	Host  string
+	Time  time.Time
+	Error error
+}
+
+////////// DEFINITION OF ALL FUNCTIONS ///////////////////////////
+
+// OnEvent calls the function
+func (f ObserverFunc) OnEvent(e Event) {
+	f(e)
+}
+
+// EventName returns the name of the event type
+func (e *FlowStarted) EventName() string { return "FlowStarted" }
+
+// EventName returns the name of the event type
+func (e *FlowFinished) EventName() string { return "FlowFinished" }
+
+// EventName returns the name of the event type
+func (e *JobStarted) EventName() string { return "JobStarted" }
+
+// EventName returns the name of the event type
+func (e *JobFinished) EventName() string { return "JobFinished" }
+
+// EventName returns the name of the event type
+func (e *TaskStarted) EventName() string { return "TaskStarted" }
+
+// EventName returns the name of the event type
+func (e *TaskFinished) EventName() string { return "TaskFinished" }
+
+// EventName returns the name of the event type
+func (e *HostUnreachable) EventName() string { return "HostUnreachable" }
+
+// AddObserver registers an observer receiving the events
+// of the flow and of all its jobs
+func (f *Flow) AddObserver(o Observer) {
+	f.observers = append(f.observers, o)
+}
+
+// AddObserver registers an observer receiving the events
+// of the job and its tasks
+func (job *Job) AddObserver(o Observer) {
+	job.observers = append(job.observers, o)
+}
+
+//////////////// INTERNAL FUNCTIONS ////////////////////
+
+// notify sends the event to all flow observers
+func (f *Flow) notify(e Event) {
+	for _, o := range f.observers {
+		o.OnEvent(e)
+	}
+}
+
+// notify sends the event to all job observers
+func (job *Job) notify(e Event) {
+	for _, o := range job.observers {
+		o.OnEvent(e)
+	}
+}
+
+// finishTask sends the event of the task finished
+func (job *Job) finishTask(task *Task, res *CmdResult) {
+	job.notify(&TaskFinished{
+		Job:      job,
+		Task:     task,
+		Host:     job.Hosts,
+		Time:     time.Now(),
+		Result:   res,
+		Duration: res.Duration,
+	})
+}
+
+// failTask records the task as failed because it could
+// not be executed and sends the event of the task finished
+func (job *Job) failTask(task *Task, err error, start time.Time) *CmdResult {
+	res := &CmdResult{Error: err, Result: map[string]interface{}{}, Status: FAILED}
+	if !start.IsZero() {
+		res.Duration = time.Since(start)
+	}
+
+	job.setResult(task.Name, res)
+	job.finishTask(task, res)
+
+	return res
+}
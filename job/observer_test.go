@@ -0,0 +1,98 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	mutex  sync.Mutex
+	events []string
+	tasks  map[string]*TaskFinished
+}
+
+func (r *recorder) OnEvent(e Event) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	name := e.EventName()
+
+	switch ev := e.(type) {
+	case *JobStarted:
+		name += ":" + ev.Job.Name
+	case *JobFinished:
+		name += ":" + ev.Job.Name
+	case *TaskStarted:
+		name += ":" + ev.Task.Name
+	case *TaskFinished:
+		name += ":" + ev.Task.Name
+		r.tasks[ev.Task.Name] = ev
+	}
+
+	r.events = append(r.events, name)
+}
+
+func TestObservers(t *testing.T) {
+	ok := func(ctx context.Context, m map[string]interface{}) *CmdResult {
+		return &CmdResult{Error: nil, Result: map[string]interface{}{}}
+	}
+
+	nok := func(ctx context.Context, m map[string]interface{}) *CmdResult {
+		return &CmdResult{Error: errors.New("NOK"), Result: map[string]interface{}{}}
+	}
+
+	task1 := &Task{Name: "task1", Cmd: Cmd{Func: ok}, OnSuccess: "task2"}
+	task2 := &Task{Name: "task2", Cmd: Cmd{Func: ok}, When: "false", OnSuccess: "task3"}
+	task3 := &Task{Name: "task3", Cmd: Cmd{Func: nok}}
+
+	j := NewJob("job1")
+	j.Start = task1
+	j.AddTask(task1)
+	j.AddTask(task2)
+	j.AddTask(task3)
+
+	jobRecorder := &recorder{tasks: map[string]*TaskFinished{}}
+	j.AddObserver(jobRecorder)
+
+	f := NewFlow()
+	f.Jobs = []*Job{j}
+
+	flowRecorder := &recorder{tasks: map[string]*TaskFinished{}}
+	f.AddObserver(flowRecorder)
+
+	var flowFinished *FlowFinished
+	f.AddObserver(ObserverFunc(func(e Event) {
+		if ev, ok := e.(*FlowFinished); ok {
+			flowFinished = ev
+		}
+	}))
+
+	err := f.RunAllJobs()
+	assert.NotNil(t, err)
+
+	jobEvents := []string{
+		"JobStarted:job1",
+		"TaskStarted:task1",
+		"TaskFinished:task1",
+		"TaskFinished:task2",
+		"TaskStarted:task3",
+		"TaskFinished:task3",
+		"JobFinished:job1",
+	}
+
+	assert.Equal(t, append(append([]string{"FlowStarted"}, jobEvents...), "FlowFinished"), flowRecorder.events)
+	assert.Equal(t, jobEvents, jobRecorder.events)
+
+	assert.Equal(t, SUCCESS, flowRecorder.tasks["task1"].Result.Status)
+	assert.Equal(t, SKIPPED, flowRecorder.tasks["task2"].Result.Status)
+	assert.Equal(t, FAILED, flowRecorder.tasks["task3"].Result.Status)
+	assert.Equal(t, "", flowRecorder.tasks["task3"].Host)
+	assert.True(t, flowRecorder.tasks["task1"].Duration > 0)
+
+	assert.Equal(t, FAILED, flowFinished.Status)
+	assert.NotNil(t, flowFinished.Error)
+}
@@ -0,0 +1,267 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+/////////// DECLARATION OF ALL TYPES //////////////////////////
+
+const (
+	// StreamStdout is the stream of standard output lines
+	StreamStdout = "stdout"
+	// StreamStderr is the stream of error output lines
+	StreamStderr = "stderr"
+	// StreamPlanned is the stream of actions planned in check mode
+	StreamPlanned = "planned"
+)
+
+const (
+	// remoteOutputMarker prefixes output lines printed by a remote jobflow
+	remoteOutputMarker = "#jobflow-output "
+	// remoteResultMarker prefixes the job result printed by a remote jobflow
+	remoteResultMarker = "#jobflow-result "
+)
+
+// OutputLine is a line written by a task command
+type OutputLine struct {
+	Job    string
+	Task   string
+	Host   string
+	Stream string
+	Line   string
+}
+
+// OutputFunc receives the output lines of task commands
+// as soon as they are written
+type OutputFunc func(OutputLine)
+
+// CmdOutput gives commands the writers of their standard and
+// error outputs. Output is streamed line by line and kept
+// to be added to the command result.
+type CmdOutput struct {
+	// Stdout is the writer of the standard output
+	Stdout io.Writer
+	// Stderr is the writer of the error output
+	Stderr io.Writer
+
+	stdout *outputWriter
+	stderr *outputWriter
+}
+
+// outputWriter keeps all data written and sends
+// each complete line to the output function
+type outputWriter struct {
+	mutex  sync.Mutex
+	buf    bytes.Buffer
+	line   []byte
+	stream string
+	send   func(stream, line string)
+}
+
+// cmdOutputKey is the context key of the command output
+type cmdOutputKey struct{}
+
+///////// DECLARATION OF ALL GLOBAL VARIABLES ///////////
+
+// printMutex avoids mixing lines printed at the same time
+var printMutex sync.Mutex
+
+////////// DEFINITION OF ALL FUNCTIONS ///////////////////////////
+
+// OutputFromContext returns the output of the command executed with
+// the context. If the context has no output, the output returned
+// only keeps what is written.
+func OutputFromContext(ctx context.Context) *CmdOutput {
+	if out, ok := ctx.Value(cmdOutputKey{}).(*CmdOutput); ok {
+		return out
+	}
+
+	return newCmdOutput(nil)
+}
+
+// PrintOutput prints the output line on the console, prefixed
+// with its job, task and host, and logs it
+func PrintOutput(l OutputLine) {
+	var w io.Writer = os.Stdout
+	if l.Stream == StreamStderr {
+		w = os.Stderr
+	}
+
+	printOutput(w, l)
+}
+
+// PrintOutputStderr prints the output line as PrintOutput but
+// on the standard error only, so that the standard output is
+// left to a report
+func PrintOutputStderr(l OutputLine) {
+	printOutput(os.Stderr, l)
+}
+
+// StdoutString returns all the standard output written
+func (o *CmdOutput) StdoutString() string {
+	return o.stdout.String()
+}
+
+// StderrString returns all the error output written
+func (o *CmdOutput) StderrString() string {
+	return o.stderr.String()
+}
+
+// Write adds data to the output and sends each complete line
+func (w *outputWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.buf.Write(p)
+	w.line = append(w.line, p...)
+
+	for {
+		i := bytes.IndexByte(w.line, '\n')
+		if i < 0 {
+			break
+		}
+
+		w.sendLine(string(w.line[:i]))
+		w.line = w.line[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// String returns all data written
+func (w *outputWriter) String() string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.buf.String()
+}
+
+//////////////// INTERNAL FUNCTIONS ////////////////////
+
+// printOutput prints the output line prefixed with
+// its job, task and host on the writer, and logs it
+func printOutput(w io.Writer, l OutputLine) {
+	host := l.Host
+	if host == "" {
+		host = "localhost"
+	}
+
+	line := l.Line
+	if l.Stream == StreamPlanned {
+		line = "planned: " + line
+	}
+
+	printMutex.Lock()
+	fmt.Fprintf(w, "[%s][%s][%s] %s\n", l.Job, l.Task, host, line)
+	printMutex.Unlock()
+
+	log.Debugw("Task output", "job", l.Job, "task", l.Task, "hosts", host, "stream", l.Stream, "line", l.Line)
+}
+
+// newCmdOutput returns a command output sending
+// its lines to the function given if not nil
+func newCmdOutput(send func(stream, line string)) *CmdOutput {
+	o := &CmdOutput{
+		stdout: &outputWriter{stream: StreamStdout, send: send},
+		stderr: &outputWriter{stream: StreamStderr, send: send},
+	}
+
+	o.Stdout = o.stdout
+	o.Stderr = o.stderr
+
+	return o
+}
+
+// flush sends the last lines not terminated by a new line
+func (o *CmdOutput) flush() {
+	for _, w := range []*outputWriter{o.stdout, o.stderr} {
+		w.mutex.Lock()
+		if len(w.line) > 0 {
+			w.sendLine(string(w.line))
+			w.line = nil
+		}
+		w.mutex.Unlock()
+	}
+}
+
+// sendLine sends a line without its carriage return
+func (w *outputWriter) sendLine(line string) {
+	if w.send != nil {
+		w.send(w.stream, strings.TrimSuffix(line, "\r"))
+	}
+}
+
+// newTaskOutput returns the output of a task command
+// sending its lines to the job output function
+func (job *Job) newTaskOutput(task *Task) *CmdOutput {
+	if job.OnOutput == nil {
+		return newCmdOutput(nil)
+	}
+
+	return newCmdOutput(func(stream, line string) {
+		job.OnOutput(OutputLine{
+			Job:    job.Name,
+			Task:   task.Name,
+			Host:   job.Hosts,
+			Stream: stream,
+			Line:   MaskSecrets(line),
+		})
+	})
+}
+
+// printRemoteOutput prints the output line on the standard output
+// of a remote jobflow so that it is relayed by the local one
+func printRemoteOutput(l OutputLine) {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return
+	}
+
+	printMutex.Lock()
+	fmt.Println(remoteOutputMarker + string(b))
+	printMutex.Unlock()
+}
+
+// readRemoteLine reads a line printed by a remote jobflow. Output
+// lines are sent to the output function given and the job result
+// is returned if the line contains it
+func readRemoteLine(line string, onOutput OutputFunc, host string) (*remoteJobResult, error) {
+	if strings.HasPrefix(line, remoteOutputMarker) {
+		l := OutputLine{}
+
+		err := json.Unmarshal([]byte(strings.TrimPrefix(line, remoteOutputMarker)), &l)
+		if err != nil {
+			return nil, err
+		}
+
+		l.Host = host
+		l.Line = MaskSecrets(l.Line)
+		if onOutput != nil {
+			onOutput(l)
+		}
+
+		return nil, nil
+	}
+
+	if strings.HasPrefix(line, remoteResultMarker) {
+		res := &remoteJobResult{}
+
+		err := json.Unmarshal([]byte(strings.TrimPrefix(line, remoteResultMarker)), res)
+		if err != nil {
+			return nil, err
+		}
+
+		return res, nil
+	}
+
+	log.Debugw("Remote output ignored", "hosts", host, "line", line)
+
+	return nil, nil
+}
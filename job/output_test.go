@@ -0,0 +1,83 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskOutput(t *testing.T) {
+	var mutex sync.Mutex
+	lines := []OutputLine{}
+
+	task := &Task{
+		Name: "Task1",
+		Cmd: Cmd{Func: func(ctx context.Context, m map[string]interface{}) *CmdResult {
+			out := OutputFromContext(ctx)
+			fmt.Fprint(out.Stdout, "line 1\nline")
+			fmt.Fprint(out.Stderr, "error 1\n")
+			fmt.Fprint(out.Stdout, " 2\nline 3")
+
+			res := NewCmdResult()
+			res.Result["stdout"] = out.StdoutString()
+			res.Result["stderr"] = out.StderrString()
+
+			return res
+		}},
+	}
+
+	w := NewJob("Job Output")
+	w.Hosts = "host1"
+	w.OnOutput = func(l OutputLine) {
+		mutex.Lock()
+		lines = append(lines, l)
+		mutex.Unlock()
+	}
+	w.Start = task
+	w.AddTask(task)
+
+	err := w.Run("")
+	assert.Nil(t, err)
+
+	assert.Equal(t, []OutputLine{
+		{Job: "Job Output", Task: "Task1", Host: "host1", Stream: StreamStdout, Line: "line 1"},
+		{Job: "Job Output", Task: "Task1", Host: "host1", Stream: StreamStderr, Line: "error 1"},
+		{Job: "Job Output", Task: "Task1", Host: "host1", Stream: StreamStdout, Line: "line 2"},
+		{Job: "Job Output", Task: "Task1", Host: "host1", Stream: StreamStdout, Line: "line 3"},
+	}, lines)
+
+	assert.Equal(t, "line 1\nline 2\nline 3", w.Result["Task1"].Result["stdout"])
+	assert.Equal(t, "error 1\n", w.Result["Task1"].Result["stderr"])
+
+	// Output without context only keeps data
+	out := OutputFromContext(context.Background())
+	fmt.Fprintln(out.Stdout, "data")
+	assert.Equal(t, "data\n", out.StdoutString())
+}
+
+func TestReadRemoteLine(t *testing.T) {
+	lines := []OutputLine{}
+	onOutput := func(l OutputLine) {
+		lines = append(lines, l)
+	}
+
+	res, err := readRemoteLine(remoteOutputMarker+`{"Job":"job","Task":"task","Host":"localhost","Stream":"stdout","Line":"hello"}`, onOutput, "host1")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+	assert.Equal(t, []OutputLine{{Job: "job", Task: "task", Host: "host1", Stream: StreamStdout, Line: "hello"}}, lines)
+
+	res, err = readRemoteLine(remoteResultMarker+`{"Status":1,"Result":{"task":{"Error":"","Result":{"result":"ok"},"Attempts":1,"Status":1}}}`, onOutput, "host1")
+	assert.Nil(t, err)
+	assert.Equal(t, SUCCESS, res.Status)
+	assert.Equal(t, "ok", res.Result["task"].Result["result"])
+
+	res, err = readRemoteLine("other line", onOutput, "host1")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+
+	_, err = readRemoteLine(remoteOutputMarker+"{", onOutput, "host1")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,271 @@
+package job
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+/////////// DECLARATION OF ALL TYPES //////////////////////////
+
+const (
+	// ParamAny accepts values of any type
+	ParamAny = "any"
+	// ParamString accepts strings and scalar values
+	ParamString = "string"
+	// ParamBool accepts booleans
+	ParamBool = "bool"
+	// ParamInt accepts integers
+	ParamInt = "int"
+	// ParamFloat accepts numbers
+	ParamFloat = "float"
+	// ParamList accepts lists
+	ParamList = "list"
+	// ParamMap accepts maps
+	ParamMap = "map"
+)
+
+// Param describes a parameter of a command
+type Param struct {
+	// Name is the key of the param in the task params
+	Name string
+	// Type is one of ParamString, ParamBool, ParamInt, ParamFloat,
+	// ParamList, ParamMap or ParamAny. Any type if it is empty
+	Type string
+	// Required indicates the param must be specified
+	Required bool
+	// Default is the value used when the param is not specified
+	Default interface{}
+	// Description describes shortly the param
+	Description string
+	// Enum is the list of accepted values
+	Enum []interface{}
+}
+
+////////// DEFINITION OF ALL FUNCTIONS ///////////////////////////
+
+// CheckParams checks task params against the param specification
+// of the command and returns all problems found.
+//
+// Nothing is checked if the command has no specification. Type and
+// enum of values containing templates or env variables are not
+// checked because they are only known once rendered.
+func (c Cmd) CheckParams(params map[string]interface{}) []error {
+	errs := []error{}
+
+	if len(c.Params) == 0 {
+		return errs
+	}
+
+	known := make(map[string]bool)
+
+	for _, p := range c.Params {
+		known[p.Name] = true
+
+		value, ok := params[p.Name]
+		if !ok {
+			if p.Required {
+				errs = append(errs, fmt.Errorf("param %s missing", p.Name))
+			}
+
+			continue
+		}
+
+		if isDynamicValue(value) {
+			continue
+		}
+
+		err := p.check(value)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// Sort unknown params to report them always in the same order
+	unknown := []string{}
+	for k := range params {
+		if !known[k] {
+			unknown = append(unknown, k)
+		}
+	}
+
+	sort.Strings(unknown)
+	for _, k := range unknown {
+		errs = append(errs, fmt.Errorf("param %s unknown", k))
+	}
+
+	return errs
+}
+
+// DecodeParams decodes params into the struct pointed by out
+// after applying the defaults of the param specification.
+//
+// Struct fields are matched with params by their tag "param" or
+// by their name in lower case. Values are converted to the type
+// of the fields. It returns an error if a required param is missing
+// or if a value cannot be converted.
+func DecodeParams(params map[string]interface{}, specs []Param, out interface{}) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("params must be decoded into a pointer to struct")
+	}
+
+	params = applyParamDefaults(params, specs)
+
+	for _, p := range specs {
+		if _, ok := params[p.Name]; !ok && p.Required {
+			return fmt.Errorf("param %s missing", p.Name)
+		}
+	}
+
+	rv = rv.Elem()
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+
+		name := field.Tag.Get("param")
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+
+		value, ok := params[name]
+		if !ok || value == nil {
+			continue
+		}
+
+		err := setField(rv.Field(i), value)
+		if err != nil {
+			return fmt.Errorf("param %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+//////////////// INTERNAL FUNCTIONS ////////////////////
+
+// applyParamDefaults returns a copy of params in which
+// missing params with a default value are added
+func applyParamDefaults(params map[string]interface{}, specs []Param) map[string]interface{} {
+	res := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		res[k] = v
+	}
+
+	for _, p := range specs {
+		if _, ok := res[p.Name]; !ok && p.Default != nil {
+			res[p.Name] = p.Default
+		}
+	}
+
+	return res
+}
+
+// check returns an error if the value does not match
+// the type or the enum of the param
+func (p Param) check(value interface{}) error {
+	var err error
+
+	kind := reflect.ValueOf(value).Kind()
+
+	switch p.Type {
+	case "", ParamAny:
+	case ParamString:
+		if kind == reflect.Map || kind == reflect.Slice || kind == reflect.Array {
+			err = fmt.Errorf("not a string")
+		}
+	case ParamBool:
+		_, err = cast.ToBoolE(value)
+	case ParamInt:
+		_, err = cast.ToIntE(value)
+	case ParamFloat:
+		_, err = cast.ToFloat64E(value)
+	case ParamList:
+		if kind != reflect.Slice && kind != reflect.Array {
+			err = fmt.Errorf("not a list")
+		}
+	case ParamMap:
+		if kind != reflect.Map {
+			err = fmt.Errorf("not a map")
+		}
+	default:
+		err = fmt.Errorf("unknown type %s", p.Type)
+	}
+
+	if err != nil {
+		return fmt.Errorf("param %s is not of type %s: %v", p.Name, p.Type, err)
+	}
+
+	if len(p.Enum) == 0 {
+		return nil
+	}
+
+	for _, e := range p.Enum {
+		if cast.ToString(e) == cast.ToString(value) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("param %s must be one of %v: %v", p.Name, p.Enum, value)
+}
+
+// isDynamicValue returns true if the value is a string
+// containing a template or an env variable
+func isDynamicValue(value interface{}) bool {
+	str, ok := value.(string)
+
+	return ok && (strings.Contains(str, "{{") || strings.Contains(str, "$"))
+}
+
+// setField converts the value to the type of the field
+// and sets it
+func setField(field reflect.Value, value interface{}) error {
+	var v interface{}
+	var err error
+
+	switch field.Interface().(type) {
+	case string:
+		v, err = cast.ToStringE(value)
+	case bool:
+		v, err = cast.ToBoolE(value)
+	case int:
+		v, err = cast.ToIntE(value)
+	case int64:
+		v, err = cast.ToInt64E(value)
+	case float64:
+		v, err = cast.ToFloat64E(value)
+	case time.Duration:
+		v, err = cast.ToDurationE(value)
+	case []string:
+		v, err = cast.ToStringSliceE(value)
+	case []interface{}:
+		v, err = cast.ToSliceE(value)
+	case map[string]interface{}:
+		v, err = cast.ToStringMapE(value)
+	case map[string]string:
+		v, err = cast.ToStringMapStringE(value)
+	default:
+		if field.Kind() != reflect.Interface {
+			return fmt.Errorf("unsupported field type %s", field.Type())
+		}
+
+		v = value
+	}
+
+	if err != nil {
+		return err
+	}
+
+	field.Set(reflect.ValueOf(v))
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package job
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testParams = []Param{
+	{Name: "name", Type: ParamString, Required: true},
+	{Name: "count", Type: ParamInt, Default: 1},
+	{Name: "enabled", Type: ParamBool, Default: true},
+	{Name: "mode", Type: ParamString, Default: "fast", Enum: []interface{}{"fast", "slow"}},
+	{Name: "tags", Type: ParamList},
+	{Name: "labels", Type: ParamMap},
+	{Name: "timeout", Type: ParamString},
+	{Name: "extra"},
+}
+
+func TestCheckParams(t *testing.T) {
+	cmd := Cmd{Name: "test", Params: testParams}
+
+	testCases := []struct {
+		name   string
+		params map[string]interface{}
+		errs   []error
+	}{
+		{
+			"Valid",
+			map[string]interface{}{
+				"name":    "app",
+				"count":   "3",
+				"enabled": false,
+				"tags":    []interface{}{"a"},
+				"labels":  map[interface{}]interface{}{"a": "b"},
+				"extra":   []interface{}{1},
+			},
+			[]error{},
+		},
+		{
+			"Templates",
+			map[string]interface{}{
+				"name":  "{{ .context.variables.name }}",
+				"count": "{{ .context.variables.count }}",
+				"mode":  "$MODE",
+			},
+			[]error{},
+		},
+		{
+			"Invalid",
+			map[string]interface{}{
+				"count":   "many",
+				"enabled": "maybe",
+				"mode":    "medium",
+				"tags":    "a",
+				"labels":  []interface{}{"a"},
+				"other":   1,
+				"another": 2,
+			},
+			[]error{
+				fmt.Errorf("param name missing"),
+				fmt.Errorf("param count is not of type int: unable to cast \"many\" of type string to int"),
+				fmt.Errorf("param enabled is not of type bool: strconv.ParseBool: parsing \"maybe\": invalid syntax"),
+				fmt.Errorf("param mode must be one of [fast slow]: medium"),
+				fmt.Errorf("param tags is not of type list: not a list"),
+				fmt.Errorf("param labels is not of type map: not a map"),
+				fmt.Errorf("param another unknown"),
+				fmt.Errorf("param other unknown"),
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			errs := cmd.CheckParams(tc.params)
+			assert.Equal(t, len(tc.errs), len(errs), "%v", errs)
+
+			for i := range tc.errs {
+				if i < len(errs) {
+					assert.Equal(t, tc.errs[i].Error(), errs[i].Error())
+				}
+			}
+		})
+	}
+
+	// No specification, no check
+	assert.Empty(t, Cmd{}.CheckParams(map[string]interface{}{"any": 1}))
+}
+
+func TestDecodeParams(t *testing.T) {
+	type options struct {
+		Name    string                 `param:"name"`
+		Count   int                    `param:"count"`
+		Enabled bool                   `param:"enabled"`
+		Mode    string                 `param:"mode"`
+		Tags    []string               `param:"tags"`
+		Labels  map[string]interface{} `param:"labels"`
+		Timeout time.Duration          `param:"timeout"`
+		Extra   interface{}
+		ignored string
+	}
+
+	opts := options{}
+	err := DecodeParams(map[string]interface{}{
+		"name":    "app",
+		"count":   "3",
+		"tags":    []interface{}{"a", "b"},
+		"labels":  map[interface{}]interface{}{"a": "b"},
+		"timeout": "1m",
+		"extra":   []interface{}{1},
+	}, testParams, &opts)
+
+	assert.Nil(t, err)
+	assert.Equal(t, options{
+		Name:    "app",
+		Count:   3,
+		Enabled: true,
+		Mode:    "fast",
+		Tags:    []string{"a", "b"},
+		Labels:  map[string]interface{}{"a": "b"},
+		Timeout: time.Minute,
+		Extra:   []interface{}{1},
+	}, opts)
+
+	err = DecodeParams(map[string]interface{}{}, testParams, &opts)
+	assert.Equal(t, fmt.Errorf("param name missing"), err)
+
+	err = DecodeParams(map[string]interface{}{"name": "app", "count": "many"}, testParams, &opts)
+	assert.NotNil(t, err)
+
+	err = DecodeParams(map[string]interface{}{"name": "app"}, testParams, opts)
+	assert.NotNil(t, err)
+}
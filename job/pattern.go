@@ -0,0 +1,303 @@
+package job
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+////////// DEFINITION OF ALL FUNCTIONS ///////////////////////////
+
+// MatchHosts returns the names of the inventory hosts matching the
+// pattern given, in the order of the pattern.
+//
+// A pattern is a list of terms separated by ",", or by ":" if it has
+// no comma. Separators inside the brackets, braces and parentheses of
+// a regular expression do not split it, and a pattern which is only an
+// IP address such as "fe80::1" is one term. A term is:
+//
+//   - a group or a host name
+//   - "all" or "*" for all hosts
+//   - a glob such as "web-*" matching host and group names
+//   - a regular expression prefixed with "~" such as "~web-[0-9]+"
+//
+// Hosts of the terms are added, then the terms prefixed with "&"
+// keep only the hosts they match and the ones prefixed with "!"
+// remove the hosts they match. Unknown names are errors.
+func (inv *Inventory) MatchHosts(pattern string) ([]string, error) {
+	var hosts []string
+	var and, not []string
+
+	terms := splitPattern(pattern)
+
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("empty host pattern")
+	}
+
+	for _, term := range terms {
+		term = strings.TrimSpace(term)
+
+		switch {
+		case strings.HasPrefix(term, "&"):
+			and = append(and, term[1:])
+		case strings.HasPrefix(term, "!"):
+			not = append(not, term[1:])
+		default:
+			matched, err := inv.matchTerm(term)
+			if err != nil {
+				return nil, err
+			}
+
+			hosts = appendHosts(hosts, matched...)
+		}
+	}
+
+	for _, term := range and {
+		matched, err := inv.matchTerm(term)
+		if err != nil {
+			return nil, err
+		}
+
+		hosts = filterHosts(hosts, matched, true)
+	}
+
+	for _, term := range not {
+		matched, err := inv.matchTerm(term)
+		if err != nil {
+			return nil, err
+		}
+
+		hosts = filterHosts(hosts, matched, false)
+	}
+
+	return hosts, nil
+}
+
+// CheckHosts checks that the host patterns of remote jobs and the
+// limit of the flow only refer to hosts and groups of the inventory
+func (f *Flow) CheckHosts() error {
+	if f.Limit != "" {
+		if f.Inventory == nil {
+			return fmt.Errorf("no inventory to limit hosts to %s", f.Limit)
+		}
+
+		_, err := f.Inventory.MatchHosts(f.Limit)
+		if err != nil {
+			return fmt.Errorf("limit: %v", err)
+		}
+	}
+
+	for _, j := range f.Jobs {
+		if j.isLocal() {
+			continue
+		}
+
+		_, err := f.jobHosts(j)
+		if err != nil {
+			return fmt.Errorf("job %s: %v", j.Name, err)
+		}
+	}
+
+	return nil
+}
+
+//////////////// INTERNAL FUNCTIONS ////////////////////
+
+// jobHosts returns the hosts on which the job is executed: the
+// hosts matching its pattern restricted by the limit of the flow.
+// A local job is executed on localhost whatever the limit.
+func (f *Flow) jobHosts(j *Job) ([]string, error) {
+	if j.isLocal() {
+		return []string{"localhost"}, nil
+	}
+
+	if f.Inventory == nil {
+		return nil, fmt.Errorf("no inventory to find hosts %s", j.Hosts)
+	}
+
+	hosts, err := f.Inventory.MatchHosts(j.Hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.Limit == "" {
+		return hosts, nil
+	}
+
+	limit, err := f.Inventory.MatchHosts(f.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("limit: %v", err)
+	}
+
+	return filterHosts(hosts, limit, true), nil
+}
+
+// splitPattern returns the terms of a host pattern. Terms are
+// separated by commas if there is one at top level, otherwise by
+// colons. Separators are ignored inside the groups of regular
+// expressions so that "~web-[0-9]{1,2}" is one term
+func splitPattern(pattern string) []string {
+	if net.ParseIP(strings.TrimSpace(pattern)) != nil {
+		return []string{strings.TrimSpace(pattern)}
+	}
+
+	sep := ':'
+	if len(splitTerms(pattern, ',')) > 1 {
+		sep = ','
+	}
+
+	terms := []string{}
+	for _, term := range splitTerms(pattern, sep) {
+		if term = strings.TrimSpace(term); term != "" {
+			terms = append(terms, term)
+		}
+	}
+
+	return terms
+}
+
+// splitTerms splits the pattern on the separator,
+// except inside the groups of regular expression terms
+func splitTerms(pattern string, sep rune) []string {
+	terms := []string{}
+	term := []rune{}
+	depth := 0
+	escaped := false
+
+	for _, r := range pattern {
+		isRegexp := strings.HasPrefix(strings.TrimLeft(strings.TrimSpace(string(term)), "&!"), "~")
+
+		switch {
+		case escaped:
+			escaped = false
+		case r == sep && depth == 0:
+			terms = append(terms, string(term))
+			term = []rune{}
+			continue
+		case !isRegexp:
+		case r == '\\':
+			escaped = true
+		case r == '[' || r == '{' || r == '(':
+			depth++
+		case (r == ']' || r == '}' || r == ')') && depth > 0:
+			depth--
+		}
+
+		term = append(term, r)
+	}
+
+	return append(terms, string(term))
+}
+
+// matchTerm returns the hosts matched by a term of a pattern
+func (inv *Inventory) matchTerm(term string) ([]string, error) {
+	if term == "all" || term == "*" {
+		return inv.sortedHosts(func(string) bool { return true }), nil
+	}
+
+	if strings.HasPrefix(term, "~") {
+		re, err := regexp.Compile("^(?:" + term[1:] + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid host regexp %s: %v", term, err)
+		}
+
+		return inv.matchNames(re.MatchString), nil
+	}
+
+	if strings.ContainsAny(term, "*?[") {
+		_, err := filepath.Match(term, "")
+		if err != nil {
+			return nil, fmt.Errorf("invalid host glob %s: %v", term, err)
+		}
+
+		return inv.matchNames(func(name string) bool {
+			ok, _ := filepath.Match(term, name)
+			return ok
+		}), nil
+	}
+
+	if _, ok := inv.Groups[term]; ok {
+		return inv.GroupHosts(term), nil
+	}
+
+	if _, ok := inv.Hosts[term]; ok {
+		return []string{term}, nil
+	}
+
+	return nil, fmt.Errorf("unknown host or group %s", term)
+}
+
+// matchNames returns the hosts whose name matches and the hosts
+// of the groups whose name matches, groups first
+func (inv *Inventory) matchNames(match func(string) bool) []string {
+	hosts := []string{}
+
+	groups := []string{}
+	for name := range inv.Groups {
+		if match(name) {
+			groups = append(groups, name)
+		}
+	}
+
+	sort.Strings(groups)
+
+	for _, name := range groups {
+		hosts = appendHosts(hosts, inv.GroupHosts(name)...)
+	}
+
+	return appendHosts(hosts, inv.sortedHosts(match)...)
+}
+
+// sortedHosts returns the names of the hosts matching, sorted
+func (inv *Inventory) sortedHosts(match func(string) bool) []string {
+	hosts := []string{}
+	for name := range inv.Hosts {
+		if match(name) {
+			hosts = append(hosts, name)
+		}
+	}
+
+	sort.Strings(hosts)
+
+	return hosts
+}
+
+// appendHosts appends the hosts which are not in the list yet
+func appendHosts(hosts []string, add ...string) []string {
+	for _, h := range add {
+		found := false
+		for _, it := range hosts {
+			if it == h {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			hosts = append(hosts, h)
+		}
+	}
+
+	return hosts
+}
+
+// filterHosts returns the hosts of the list which are
+// in the other list if keep is true, or not in it otherwise
+func filterHosts(hosts, other []string, keep bool) []string {
+	in := make(map[string]bool, len(other))
+	for _, h := range other {
+		in[h] = true
+	}
+
+	res := []string{}
+	for _, h := range hosts {
+		if in[h] == keep {
+			res = append(res, h)
+		}
+	}
+
+	return res
+}
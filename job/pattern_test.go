@@ -0,0 +1,141 @@
+package job
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newPatternInventory() *Inventory {
+	inventory := NewInventory()
+
+	for _, h := range []string{"web-1", "web-2", "db-1", "canary"} {
+		inventory.Hosts[h] = Host{Name: h, Vars: map[string]interface{}{}}
+	}
+
+	inventory.Groups["web"] = Group{Name: "web", Hosts: []string{"web-2", "web-1", "canary"}}
+	inventory.Groups["db"] = Group{Name: "db", Hosts: []string{"db-1"}}
+	inventory.Groups["prod"] = Group{Name: "prod", Hosts: []string{"web-1", "db-1"}}
+	inventory.Groups["site"] = Group{Name: "site", Hosts: []string{"canary"}, Children: []string{"prod", "web"}}
+
+	return inventory
+}
+
+func TestMatchHosts(t *testing.T) {
+	inventory := newPatternInventory()
+
+	tests := []struct {
+		pattern string
+		hosts   []string
+	}{
+		{"web", []string{"web-2", "web-1", "canary"}},
+		{"db-1", []string{"db-1"}},
+		{"web:db", []string{"web-2", "web-1", "canary", "db-1"}},
+		{"web,db-1,web-1", []string{"web-2", "web-1", "canary", "db-1"}},
+		{"web:&prod", []string{"web-1"}},
+		{"all:!canary", []string{"db-1", "web-1", "web-2"}},
+		{"*:!web", []string{"db-1"}},
+		{"web-*", []string{"web-1", "web-2"}},
+		{"d*", []string{"db-1"}},
+		{"~web-[0-9]+", []string{"web-1", "web-2"}},
+		{"!web:db", []string{"db-1"}},
+		{"web:&db", []string{}},
+		{"site", []string{"canary", "web-1", "db-1", "web-2"}},
+		{"site:!prod", []string{"canary", "web-2"}},
+		{"~web-[0-9]{1,2}", []string{"web-1", "web-2"}},
+		{"~web-[0-9]{1,2}:!web-2", []string{"web-1"}},
+		{"~(web|db)-1,canary", []string{"db-1", "web-1", "canary"}},
+		{"~web-\\[?[0-9]{1}:&prod", []string{"web-1"}},
+	}
+
+	for _, test := range tests {
+		hosts, err := inventory.MatchHosts(test.pattern)
+		assert.Nil(t, err, test.pattern)
+		assert.Equal(t, test.hosts, hosts, test.pattern)
+	}
+
+	// Cycles between groups are reported when reading the inventory
+	inventory.Groups["web"] = Group{Name: "web", Hosts: []string{"web-1"}, Children: []string{"site"}}
+	assert.Equal(t, []string{"web-1", "canary", "db-1"}, inventory.GroupHosts("web"))
+
+	for _, pattern := range []string{"", "unknown", "web:&unknown", "web:!unknown", "~web-[", "web-["} {
+		_, err := inventory.MatchHosts(pattern)
+		assert.NotNil(t, err, pattern)
+	}
+}
+
+func TestSplitPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		terms   []string
+	}{
+		{"web:db", []string{"web", "db"}},
+		{"web, db ,!canary", []string{"web", "db", "!canary"}},
+		{"~web-[0-9]{1,2}:&prod", []string{"~web-[0-9]{1,2}", "&prod"}},
+		{"!~(a|b:c):web", []string{"!~(a|b:c)", "web"}},
+		{"fe80::1", []string{"fe80::1"}},
+		{"fe80::1,2001:db8::2", []string{"fe80::1", "2001:db8::2"}},
+		{"web:", []string{"web"}},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.terms, splitPattern(test.pattern), test.pattern)
+	}
+
+	inventory := NewInventory()
+	inventory.Hosts["fe80::1"] = Host{Name: "fe80::1"}
+	inventory.Hosts["2001:db8::2"] = Host{Name: "2001:db8::2"}
+
+	hosts, err := inventory.MatchHosts("fe80::1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"fe80::1"}, hosts)
+
+	hosts, err = inventory.MatchHosts("all,!fe80::1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2001:db8::2"}, hosts)
+}
+
+func TestCheckHosts(t *testing.T) {
+	executed := false
+
+	ok := func(ctx context.Context, m map[string]interface{}) *CmdResult {
+		executed = true
+		return NewCmdResult()
+	}
+
+	local := newFlowJob("build", nil, ok)
+
+	remote := newFlowJob("deploy", []string{"build"}, ok)
+	remote.Hosts = "web:&unknown"
+
+	f := NewFlow()
+	f.OnOutput = nil
+	f.Inventory = newPatternInventory()
+	f.Jobs = []*Job{local, remote}
+
+	// Unknown names fail the flow before any job is executed
+	err := f.RunAllJobs()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "job deploy: unknown host or group unknown")
+	assert.False(t, executed)
+
+	remote.Hosts = "web"
+	f.Limit = "prod:unknown"
+	assert.NotNil(t, f.CheckHosts())
+
+	// Limit restricts remote jobs only
+	f.Limit = "prod"
+	assert.Nil(t, f.CheckHosts())
+
+	hosts, err := f.jobHosts(remote)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"web-1"}, hosts)
+
+	hosts, err = f.jobHosts(local)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"localhost"}, hosts)
+
+	f.Inventory = nil
+	assert.NotNil(t, f.CheckHosts())
+}
@@ -0,0 +1,171 @@
+package job
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig"
+	"github.com/spf13/cast"
+	"gopkg.in/yaml.v2"
+)
+
+////////// DECLARATION OF ALL GLOBAL VARIABLES ///////////
+
+// nativeMarker prefixes the output of template functions returning
+// a value whose type must be kept once the param is rendered
+const nativeMarker = "\x00jobflow-native:"
+
+//////////////// INTERNAL FUNCTIONS ////////////////////
+
+// templateFuncs returns the functions available in templates:
+// sprig functions and the functions keeping native types.
+//
+// - native returns its argument with its type, for example a list or a map
+// - fromYaml and fromJson parse a string and return the value decoded
+func templateFuncs() template.FuncMap {
+	funcs := sprig.TxtFuncMap()
+
+	funcs["native"] = func(v interface{}) (string, error) {
+		return nativeString(v)
+	}
+
+	funcs["fromYaml"] = func(str string) (string, error) {
+		var v interface{}
+
+		err := yaml.Unmarshal([]byte(str), &v)
+		if err != nil {
+			return "", err
+		}
+
+		return nativeString(v)
+	}
+
+	funcs["fromJson"] = func(str string) (string, error) {
+		var v interface{}
+
+		err := json.Unmarshal([]byte(str), &v)
+		if err != nil {
+			return "", err
+		}
+
+		return nativeString(v)
+	}
+
+	return funcs
+}
+
+// nativeString encodes a value in JSON behind the native marker
+func nativeString(v interface{}) (string, error) {
+	b, err := json.Marshal(normalizeValue(v))
+	if err != nil {
+		return "", err
+	}
+
+	return nativeMarker + string(b), nil
+}
+
+// renderValue renders recursively templates of a param value.
+//
+// Strings in maps and lists are rendered. A list of strings stays
+// a list of strings. Other values are kept as they are.
+func renderValue(task, key string, value interface{}, data map[string]interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		str, err := renderParamTemplate(task, key, v, data)
+		if err != nil {
+			return nil, err
+		}
+
+		return typedValue(task, key, v, str)
+	case []string:
+		arr := make([]string, len(v))
+		for idx, it := range v {
+			str, err := renderParamTemplate(task, key+"["+cast.ToString(idx)+"]", it, data)
+			if err != nil {
+				return nil, err
+			}
+
+			arr[idx] = str
+		}
+
+		return arr, nil
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for idx, it := range v {
+			r, err := renderValue(task, key+"["+cast.ToString(idx)+"]", it, data)
+			if err != nil {
+				return nil, err
+			}
+
+			arr[idx] = r
+		}
+
+		return arr, nil
+	case map[interface{}]interface{}:
+		return renderValue(task, key, cast.ToStringMap(v), data)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, it := range v {
+			r, err := renderValue(task, key+"."+k, it, data)
+			if err != nil {
+				return nil, err
+			}
+
+			m[k] = r
+		}
+
+		return m, nil
+	}
+
+	kind := reflect.ValueOf(value).Kind()
+	if kind == reflect.Map || kind == reflect.Struct || kind == reflect.Ptr {
+		log.Warnw("Param kind ignored", "task", task, "key", key, "kind", kind)
+	}
+
+	return value, nil
+}
+
+// typedValue returns the native value of a rendered string.
+//
+// The value of a native marker is decoded. Otherwise, when the template
+// is a unique action whose output is a bool or a number written exactly
+// as Go formats it, the bool or the number is returned. In all other
+// cases, the rendered string is returned.
+func typedValue(task, key, tpl, rendered string) (interface{}, error) {
+	if strings.HasPrefix(rendered, nativeMarker) {
+		var v interface{}
+
+		err := yaml.Unmarshal([]byte(strings.TrimPrefix(rendered, nativeMarker)), &v)
+		if err != nil {
+			return nil, fmt.Errorf("task %s: param %s: cannot decode native value: %v", task, key, err)
+		}
+
+		return normalizeValue(v), nil
+	}
+
+	if strings.Contains(rendered, nativeMarker) {
+		return nil, fmt.Errorf("task %s: param %s: native value must be the whole param", task, key)
+	}
+
+	if !reSingleAction.MatchString(tpl) || strings.Count(tpl, "{{") != 1 {
+		return rendered, nil
+	}
+
+	if b, err := strconv.ParseBool(rendered); err == nil && strconv.FormatBool(b) == rendered {
+		return b, nil
+	}
+
+	if i, err := strconv.Atoi(rendered); err == nil && strconv.Itoa(i) == rendered {
+		return i, nil
+	}
+
+	if f, err := strconv.ParseFloat(rendered, 64); err == nil && strconv.FormatFloat(f, 'f', -1, 64) == rendered {
+		return f, nil
+	}
+
+	return rendered, nil
+}
@@ -0,0 +1,378 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cast"
+)
+
+/////////// DECLARATION OF ALL TYPES //////////////////////////
+
+// SecretMask replaces secret values in logs, outputs and results
+const SecretMask = "****"
+
+// MinSecretLength is the minimum length of a value found secret by
+// the name of its param. Shorter values such as "true" or "8" would
+// be masked everywhere
+const MinSecretLength = 4
+
+// secretRegistry contains the secret values to mask and the
+// patterns of param names whose values are secret
+type secretRegistry struct {
+	mutex    sync.RWMutex
+	values   map[string]bool
+	sorted   []string
+	words    []*regexp.Regexp
+	patterns map[string]*regexp.Regexp
+}
+
+///////// DECLARATION OF ALL GLOBAL VARIABLES ///////////
+
+// DefaultSecretPatterns are the patterns of param names whose values
+// are secret by default. They match whole words of the names, words
+// being separated by non alphanumeric characters or a change of case,
+// so that db_password, apiToken or api_key match but bypass_cache
+// does not
+var DefaultSecretPatterns = []string{
+	"token",
+	"pass(word|wd|phrase)?",
+	"secret",
+	"(api|access|private)?key",
+}
+
+var secrets = newSecretRegistry()
+
+// camelCaseRegexp matches a change of case between two words
+var camelCaseRegexp = regexp.MustCompile("([a-z0-9])([A-Z])")
+
+////////// DEFINITION OF ALL FUNCTIONS ///////////////////////////
+
+// AddSecret marks a value as secret. It is masked wherever it
+// appears in logs, task outputs, results and reports. Blank
+// values are ignored
+func AddSecret(value string) {
+	if strings.TrimSpace(value) == "" {
+		return
+	}
+
+	secrets.mutex.Lock()
+	defer secrets.mutex.Unlock()
+
+	if secrets.values[value] {
+		return
+	}
+
+	secrets.values[value] = true
+
+	// Longest values are replaced first in case
+	// a secret contains another one
+	secrets.sorted = append(secrets.sorted, value)
+	sort.Slice(secrets.sorted, func(i, j int) bool {
+		return len(secrets.sorted[i]) > len(secrets.sorted[j])
+	})
+}
+
+// AddSecretPatterns adds patterns of param names whose values
+// are secret. Patterns are case insensitive regular expressions
+// matching a part of the name. Patterns already added are ignored.
+func AddSecretPatterns(patterns ...string) error {
+	res := make(map[string]*regexp.Regexp)
+
+	for _, p := range patterns {
+		re, err := regexp.Compile("(?i)" + p)
+		if err != nil {
+			return fmt.Errorf("invalid secret pattern %s: %v", p, err)
+		}
+
+		res[p] = re
+	}
+
+	secrets.mutex.Lock()
+	for p, re := range res {
+		secrets.patterns[p] = re
+	}
+	secrets.mutex.Unlock()
+
+	return nil
+}
+
+// IsSecretName returns true if a param with the
+// name given contains a secret value
+func IsSecretName(name string) bool {
+	secrets.mutex.RLock()
+	defer secrets.mutex.RUnlock()
+
+	words := strings.ToLower(camelCaseRegexp.ReplaceAllString(name, "${1}_${2}"))
+	for _, re := range secrets.words {
+		if re.MatchString(words) {
+			return true
+		}
+	}
+
+	for _, re := range secrets.patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ResetSecrets forgets all secret values and secret patterns
+// added. Only the default patterns are kept
+func ResetSecrets() {
+	r := newSecretRegistry()
+
+	secrets.mutex.Lock()
+	defer secrets.mutex.Unlock()
+
+	secrets.values = r.values
+	secrets.sorted = r.sorted
+	secrets.words = r.words
+	secrets.patterns = r.patterns
+}
+
+// MaskSecrets replaces all secret values in the string
+func MaskSecrets(str string) string {
+	secrets.mutex.RLock()
+	defer secrets.mutex.RUnlock()
+
+	for _, value := range secrets.sorted {
+		str = strings.Replace(str, value, SecretMask, -1)
+	}
+
+	return str
+}
+
+// MaskValue returns a copy of the value in which secret values
+// are masked in all strings, including in maps and lists
+func MaskValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return MaskSecrets(v)
+	case []string:
+		res := make([]string, len(v))
+		for i, it := range v {
+			res[i] = MaskSecrets(it)
+		}
+
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, it := range v {
+			res[i] = MaskValue(it)
+		}
+
+		return res
+	case map[string]interface{}:
+		return MaskMap(v)
+	case map[interface{}]interface{}:
+		return MaskMap(cast.ToStringMap(v))
+	}
+
+	return value
+}
+
+// MaskMap returns a copy of the map in which secret values are masked
+func MaskMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+
+	res := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		res[k] = MaskValue(v)
+	}
+
+	return res
+}
+
+// MaskResult returns a copy of the command result in which
+// secret values are masked in the result, facts and error
+func MaskResult(res *CmdResult) *CmdResult {
+	if res == nil {
+		return nil
+	}
+
+	masked := *res
+	masked.Result = MaskMap(res.Result)
+	masked.Facts = MaskMap(res.Facts)
+
+	if res.Error != nil {
+		masked.Error = maskError(res.Error)
+	}
+
+	if res.AttemptResults != nil {
+		masked.AttemptResults = make([]Attempt, len(res.AttemptResults))
+		for i, a := range res.AttemptResults {
+			masked.AttemptResults[i] = a
+			if a.Error != nil {
+				masked.AttemptResults[i].Error = maskError(a.Error)
+			}
+		}
+	}
+
+	planned := make([]string, len(res.Planned))
+	for i, action := range res.Planned {
+		planned[i] = MaskSecrets(action)
+	}
+
+	if res.Planned != nil {
+		masked.Planned = planned
+	}
+
+	return &masked
+}
+
+//////////////// INTERNAL FUNCTIONS ////////////////////
+
+// newSecretRegistry returns a registry with the default patterns
+// matching whole words of names
+func newSecretRegistry() *secretRegistry {
+	r := &secretRegistry{
+		values:   make(map[string]bool),
+		patterns: make(map[string]*regexp.Regexp),
+	}
+
+	for _, p := range DefaultSecretPatterns {
+		r.words = append(r.words, regexp.MustCompile("(^|[^a-z0-9])(?:"+p+")([^a-z0-9]|$)"))
+	}
+
+	return r
+}
+
+// addNamedSecret marks as secret a value found by the name of its
+// param. Values shorter than MinSecretLength are ignored
+func addNamedSecret(value string) {
+	if len(strings.TrimSpace(value)) < MinSecretLength {
+		return
+	}
+
+	AddSecret(value)
+}
+
+// hasSecrets returns true if at least one secret value is known
+func hasSecrets() bool {
+	secrets.mutex.RLock()
+	defer secrets.mutex.RUnlock()
+
+	return len(secrets.sorted) > 0
+}
+
+// maskError returns the error with secret values masked. The error
+// is returned as it is if it contains no secret, so that its type is kept
+func maskError(err error) error {
+	msg := err.Error()
+
+	masked := MaskSecrets(msg)
+	if masked == msg {
+		return err
+	}
+
+	return errors.New(masked)
+}
+
+// maskLogValue masks the secrets of a value logged. Values which are
+// not strings are formatted if they contain secrets
+func maskLogValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, bool, int, int64, float64:
+		return v
+	case string:
+		return MaskSecrets(v)
+	case error:
+		return maskError(v)
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return value
+	}
+
+	str := fmt.Sprintf("%+v", value)
+
+	masked := MaskSecrets(str)
+	if masked == str {
+		return value
+	}
+
+	return masked
+}
+
+// addSecretValues marks as secret all strings of the value after
+// expanding environment variables with the add function given.
+// Other values such as numbers or booleans are not secret
+func addSecretValues(value interface{}, add func(string)) {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, it := range v {
+			addSecretValues(it, add)
+		}
+	case []string:
+		for _, it := range v {
+			addSecretValues(it, add)
+		}
+	case map[string]interface{}:
+		for _, it := range v {
+			addSecretValues(it, add)
+		}
+	case map[interface{}]interface{}:
+		for _, it := range v {
+			addSecretValues(it, add)
+		}
+	case string:
+		add(v)
+		add(os.ExpandEnv(v))
+	}
+}
+
+// registerSecrets marks as secret the values of the variables
+// listed in the flow secrets, whatever their length, and adds
+// its secret patterns
+func (f *Flow) registerSecrets() error {
+	err := AddSecretPatterns(f.SecretPatterns...)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range f.Secrets {
+		found := false
+
+		// Secret variables can be defined in all variable layers
+		layers := append([]VarLayer{{Vars: f.Variables}}, f.ExtraVars...)
+		for _, j := range f.Jobs {
+			layers = append(layers, VarLayer{Vars: j.Variables})
+
+			for _, task := range j.AllTasks() {
+				layers = append(layers, VarLayer{Vars: task.Vars})
+			}
+		}
+
+		if f.Inventory != nil {
+			layers = append(layers, VarLayer{Vars: f.Inventory.Global})
+			for _, h := range f.Inventory.Hosts {
+				layers = append(layers, VarLayer{Vars: h.Vars})
+			}
+		}
+
+		for _, l := range layers {
+			if value, ok := l.Vars[name]; ok {
+				addSecretValues(value, AddSecret)
+				found = true
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("secret variable %s does not exist", name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaskSecrets(t *testing.T) {
+	defer ResetSecrets()
+
+	AddSecret("s3cr3t-value")
+	AddSecret("s3cr3t-value-longer")
+	AddSecret("  ")
+
+	// Short values found by name and values which are not strings are not secret
+	addNamedSecret("8")
+	addSecretValues(map[string]interface{}{"length": 12345, "enabled": true}, addNamedSecret)
+	assert.Equal(t, "length 8, 12345 true", MaskSecrets("length 8, 12345 true"))
+
+	// Short values declared secret are masked
+	addSecretValues(map[string]interface{}{"pin": "42"}, AddSecret)
+	assert.Equal(t, "pin ****", MaskSecrets("pin 42"))
+
+	assert.Equal(t, "token=****", MaskSecrets("token=s3cr3t-value"))
+	assert.Equal(t, "a **** b", MaskSecrets("a s3cr3t-value-longer b"))
+	assert.Equal(t, "nothing to mask", MaskSecrets("nothing to mask"))
+
+	value := MaskValue(map[string]interface{}{
+		"list":   []interface{}{"s3cr3t-value", 10},
+		"nested": map[interface{}]interface{}{"key": "x s3cr3t-value"},
+	})
+	assert.Equal(t, map[string]interface{}{
+		"list":   []interface{}{"****", 10},
+		"nested": map[string]interface{}{"key": "x ****"},
+	}, value)
+
+	res := &CmdResult{
+		Status:  FAILED,
+		Error:   errors.New("auth failed with s3cr3t-value"),
+		Result:  map[string]interface{}{"stdout": "s3cr3t-value"},
+		Planned: []string{"login with s3cr3t-value"},
+	}
+
+	masked := MaskResult(res)
+	assert.Equal(t, "auth failed with ****", masked.Error.Error())
+	assert.Equal(t, "****", masked.Result["stdout"])
+	assert.Equal(t, []string{"login with ****"}, masked.Planned)
+
+	// Result given is not modified
+	assert.Equal(t, "s3cr3t-value", res.Result["stdout"])
+
+	assert.Equal(t, "err ****", maskLogValue(errors.New("err s3cr3t-value")).(error).Error())
+	assert.Equal(t, "[****]", maskLogValue([]string{"s3cr3t-value"}))
+	assert.Equal(t, 10, maskLogValue(10))
+}
+
+func TestIsSecretName(t *testing.T) {
+	defer ResetSecrets()
+
+	assert.True(t, IsSecretName("token"))
+	assert.True(t, IsSecretName("GITHUB_TOKEN"))
+	assert.True(t, IsSecretName("headers.Password"))
+	assert.True(t, IsSecretName("jobflow_ssh_pass"))
+	assert.True(t, IsSecretName("apiToken"))
+	assert.True(t, IsSecretName("db-passwd"))
+	assert.True(t, IsSecretName("ssh_passphrase"))
+	assert.True(t, IsSecretName("api_key"))
+	assert.True(t, IsSecretName("APIKEY"))
+	assert.True(t, IsSecretName("awsAccessKey"))
+	assert.False(t, IsSecretName("version"))
+
+	// Default patterns match whole words only
+	assert.False(t, IsSecretName("bypass_cache"))
+	assert.False(t, IsSecretName("passthrough"))
+	assert.False(t, IsSecretName("tokens_count"))
+	assert.False(t, IsSecretName("keyboard"))
+
+	assert.NotNil(t, AddSecretPatterns("[invalid"))
+
+	// Patterns added match a part of the name and are added once
+	assert.Nil(t, AddSecretPatterns("api_?key", "api_?key"))
+	assert.Nil(t, AddSecretPatterns("api_?key"))
+	assert.True(t, IsSecretName("MY_APIKEYS"))
+	assert.Len(t, secrets.patterns, 1)
+
+	ResetSecrets()
+	assert.False(t, IsSecretName("MY_APIKEYS"))
+	assert.Len(t, secrets.patterns, 0)
+}
+
+func TestFlowSecrets(t *testing.T) {
+	defer ResetSecrets()
+
+	var mutex sync.Mutex
+	lines := []string{}
+
+	echo := func(ctx context.Context, m map[string]interface{}) *CmdResult {
+		fmt.Fprintf(OutputFromContext(ctx).Stdout, "login %s with %s\n", m["user"], m["api_key"])
+
+		res := NewCmdResult()
+		res.Result["user"] = m["user"]
+		res.Result["variable"] = m["variable"]
+
+		return res
+	}
+
+	task := &Task{
+		Name: "login",
+		Cmd:  Cmd{Func: echo},
+		Params: map[string]interface{}{
+			"user":     "admin",
+			"api_key":  "flow-api-key-value",
+			"variable": "{{ .context.variables.db }}",
+		},
+	}
+
+	j := NewJob("job1")
+	j.AddTask(task)
+
+	f := NewFlow()
+	f.Variables = map[string]interface{}{"db": "flow-db-password"}
+	f.Secrets = []string{"db"}
+	f.SecretPatterns = []string{"api_?key"}
+	f.Jobs = []*Job{j}
+	f.OnOutput = func(l OutputLine) {
+		mutex.Lock()
+		lines = append(lines, l.Line)
+		mutex.Unlock()
+	}
+
+	err := f.RunAllJobs()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"login admin with ****"}, lines)
+
+	// Results keep the real values for the next tasks
+	res := f.Result["localhost"][0].Result["login"]
+	assert.Equal(t, "flow-db-password", res.Result["variable"])
+	assert.Equal(t, "****", MaskResult(res).Result["variable"])
+	assert.Equal(t, "admin", MaskResult(res).Result["user"])
+
+	// Secrets are sent to the remote flow
+	content, err := f.generateLocalFlowRemoteMachine(j)
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "secrets:")
+	assert.Contains(t, string(content), "secret_patterns:")
+
+	// Secret variables must exist
+	f = NewFlow()
+	f.Secrets = []string{"unknown"}
+	f.OnOutput = nil
+
+	assert.NotNil(t, f.RunAllJobs())
+}
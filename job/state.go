@@ -0,0 +1,181 @@
+package job
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+/////////// DECLARATION OF ALL TYPES //////////////////////////
+
+// State is the state of a flow run. It is saved in a state
+// file to resume the flow from the tasks failed
+type State struct {
+	// FlowHash is the hash of the flow file executed. It allows
+	// to detect that the flow changed before resuming it
+	FlowHash string
+	// Jobs contains the task results of each job
+	// by job name and host
+	Jobs map[string]map[string]*CmdResult
+}
+
+// StateFile is an observer saving the state of the flow
+// run in a file each time a task is finished
+type StateFile struct {
+	path  string
+	state *State
+	mutex sync.Mutex
+}
+
+////////// DEFINITION OF ALL FUNCTIONS ///////////////////////////
+
+// NewState returns an empty state of the flow with the hash given
+func NewState(hash string) *State {
+	return &State{
+		FlowHash: hash,
+		Jobs:     make(map[string]map[string]*CmdResult),
+	}
+}
+
+// ReadStateFile reads the state of a flow run saved in a file
+func ReadStateFile(path string) (*State, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	state := NewState("")
+
+	err = json.Unmarshal(content, state)
+	if err != nil {
+		return nil, err
+	}
+
+	if state.Jobs == nil {
+		state.Jobs = make(map[string]map[string]*CmdResult)
+	}
+
+	return state, nil
+}
+
+// Results returns the task results of the job on the host given
+func (s *State) Results(job, host string) map[string]*CmdResult {
+	return s.Jobs[stateKey(job, host)]
+}
+
+// NewStateFile returns an observer saving the state of the flow
+// with the hash given in the file. Task results of the previous
+// state are kept if it is not nil, for example when resuming.
+func NewStateFile(path, hash string, previous *State) *StateFile {
+	state := NewState(hash)
+
+	if previous != nil {
+		for k, results := range previous.Jobs {
+			state.Jobs[k] = make(map[string]*CmdResult, len(results))
+			for task, res := range results {
+				state.Jobs[k][task] = res
+			}
+		}
+	}
+
+	return &StateFile{path: path, state: state}
+}
+
+// OnEvent records the result of the task finished and saves the state
+func (s *StateFile) OnEvent(e Event) {
+	ev, ok := e.(*TaskFinished)
+	if !ok {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := stateKey(ev.Job.Name, ev.Host)
+	if s.state.Jobs[key] == nil {
+		s.state.Jobs[key] = make(map[string]*CmdResult)
+	}
+
+	s.state.Jobs[key][ev.Task.Name] = ev.Result
+
+	err := s.save()
+	if err != nil {
+		log.Errorw("Cannot save state file", "file", s.path, "err", err)
+	}
+}
+
+//////////////// INTERNAL FUNCTIONS ////////////////////
+
+// save writes the state in a temporary file renamed afterwards
+// so that the state file is never partially written
+func (s *StateFile) save() error {
+	content, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+
+	err = ioutil.WriteFile(tmp, content, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+// stateKey returns the key of the job on the host in the state
+func stateKey(job, host string) string {
+	if host == "" {
+		host = "localhost"
+	}
+
+	return job + "@" + host
+}
+
+// resumeJob sets the task results of the previous run
+// of the job on its host if the flow is resumed
+func (f *Flow) resumeJob(job *Job, host string) {
+	if f.Resume == nil {
+		return
+	}
+
+	job.Resume = make(map[string]*CmdResult)
+	for task, res := range f.Resume.Results(job.Name, host) {
+		if res != nil && res.Status == SUCCESS {
+			job.Resume[task] = res
+		}
+	}
+}
+
+// resumedResult returns the result of the task if it
+// succeeded in the previous run of the job
+func (job *Job) resumedResult(task string) *CmdResult {
+	res, ok := job.Resume[task]
+	if !ok || res == nil || res.Status != SUCCESS {
+		return nil
+	}
+
+	return res
+}
+
+// restoreTask restores the result of a task succeeded in the
+// previous run of the job instead of executing it. The results
+// of the tasks of a group are restored too.
+func (job *Job) restoreTask(task *Task, res *CmdResult) *CmdResult {
+	log.Infow("Task resumed", "task", task.Name, "reason", "succeeded in the previous run")
+
+	for _, tasks := range [][]*Task{task.Block, task.Rescue, task.Always} {
+		for _, t := range tasks {
+			if r, ok := job.Resume[t.Name]; ok && r != nil {
+				job.restoreTask(t, r)
+			}
+		}
+	}
+
+	job.recordResult(task, res)
+
+	return res
+}
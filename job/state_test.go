@@ -0,0 +1,164 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResumeFlow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobflow-state")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state.json")
+
+	var mutex sync.Mutex
+	calls := make(map[string]int)
+	fail := true
+
+	newFlow := func() *Flow {
+		count := func(name string) {
+			mutex.Lock()
+			calls[name]++
+			mutex.Unlock()
+		}
+
+		build := func(ctx context.Context, m map[string]interface{}) *CmdResult {
+			count("build")
+			return &CmdResult{Result: map[string]interface{}{"version": "1.0"}}
+		}
+
+		release := func(ctx context.Context, m map[string]interface{}) *CmdResult {
+			count("release")
+			if fail {
+				return &CmdResult{Error: errors.New("NOK"), Result: map[string]interface{}{}}
+			}
+
+			return &CmdResult{Result: map[string]interface{}{"version": m["version"]}}
+		}
+
+		build1 := &Task{Name: "build1", Cmd: Cmd{Func: build}, OnSuccess: "build2"}
+		build2 := &Task{Name: "build2", Cmd: Cmd{Func: build}, Register: "build", OnSuccess: "release"}
+		release1 := &Task{
+			Name:   "release",
+			Cmd:    Cmd{Func: release},
+			Params: map[string]interface{}{"version": "{{ .context.facts.build.version }}"},
+		}
+
+		cleanup := func(ctx context.Context, m map[string]interface{}) *CmdResult {
+			count("cleanup")
+			return &CmdResult{Result: map[string]interface{}{}}
+		}
+
+		j := NewJob("job1")
+		j.AddTask(build1)
+		j.AddTask(build2)
+		j.AddTask(release1)
+		j.Always = []*Task{{Name: "cleanup", Cmd: Cmd{Func: cleanup}}}
+
+		f := NewFlow()
+		f.OnOutput = nil
+		f.Hash = "hash"
+		f.Jobs = []*Job{j}
+
+		return f
+	}
+
+	f := newFlow()
+	f.AddObserver(NewStateFile(path, f.Hash, nil))
+
+	err = f.RunAllJobs()
+	assert.NotNil(t, err)
+
+	state, err := ReadStateFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "hash", state.FlowHash)
+
+	results := state.Results("job1", "localhost")
+	assert.Equal(t, SUCCESS, results["build1"].Status)
+	assert.Equal(t, SUCCESS, results["build2"].Status)
+	assert.Equal(t, FAILED, results["release"].Status)
+	assert.Equal(t, "NOK", results["release"].Error.Error())
+	assert.Equal(t, SUCCESS, results["cleanup"].Status)
+
+	// Resume from the failed task with the results restored
+	fail = false
+
+	f = newFlow()
+	f.Resume = state
+	f.AddObserver(NewStateFile(path, f.Hash, state))
+
+	err = f.RunAllJobs()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, calls["build"])
+	assert.Equal(t, 2, calls["release"])
+
+	// Always tasks are executed again even if they succeeded
+	assert.Equal(t, 2, calls["cleanup"])
+
+	j := f.Result["localhost"][0]
+	assert.Equal(t, "1.0", j.Result["build2"].Result["version"])
+	assert.Equal(t, "1.0", cast.ToString(j.Result["release"].Result["version"]))
+
+	state, err = ReadStateFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, SUCCESS, state.Results("job1", "localhost")["release"].Status)
+}
+
+func TestResumeGroupAlways(t *testing.T) {
+	calls := make(map[string]int)
+
+	fn := func(name string) CmdFunc {
+		return func(ctx context.Context, m map[string]interface{}) *CmdResult {
+			calls[name]++
+			return &CmdResult{Result: map[string]interface{}{}}
+		}
+	}
+
+	group := &Task{
+		Name:   "group",
+		Block:  []*Task{{Name: "deploy", Cmd: Cmd{Func: fn("deploy")}}},
+		Always: []*Task{{Name: "unlock", Cmd: Cmd{Func: fn("unlock")}}},
+	}
+
+	j := NewJob("job1")
+	j.AddTask(group)
+	j.Start = group
+	j.Resume = map[string]*CmdResult{
+		"deploy": {Status: SUCCESS, Result: map[string]interface{}{}},
+		"unlock": {Status: SUCCESS, Result: map[string]interface{}{}},
+	}
+
+	err := j.Run("")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, calls["deploy"])
+	assert.Equal(t, 1, calls["unlock"])
+}
+
+func TestGenerateRemoteFlowResume(t *testing.T) {
+	j := NewJob("job1")
+	j.AddTask(&Task{Name: "task1", Cmd: Cmd{Name: "cmd", Plugin: Plugin{Name: "plugin"}}})
+
+	f := NewFlow()
+	f.Resume = NewState("hash")
+	f.Resume.Jobs["job1@web1"] = map[string]*CmdResult{
+		"task1": {Status: SUCCESS, Result: map[string]interface{}{"key": "value"}},
+		"task2": {Status: FAILED, Error: errors.New("NOK"), Result: map[string]interface{}{}},
+	}
+
+	f.resumeJob(j, "web1")
+	assert.Equal(t, 1, len(j.Resume))
+	assert.NotNil(t, j.Resume["task1"])
+
+	content, err := f.generateLocalFlowRemoteMachine(j)
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "resume:")
+}
@@ -0,0 +1,183 @@
+package job
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+/////////// DECLARATION OF ALL TYPES //////////////////////////
+
+// VarLayer is a set of variables with the source defining them.
+//
+// Variables of a job on a host are merged from the layers below,
+// from the lowest precedence to the highest:
+//
+//   - inventory global
+//   - vars of the inventory groups of the host, parent groups first,
+//     then by priority and by name
+//   - vars of the inventory host
+//   - flow variables
+//   - job variables
+//   - task vars, for the task only
+//   - vars files given by --vars-file, in their order
+//   - variables given by --var
+type VarLayer struct {
+	Source string
+	Vars   map[string]interface{}
+}
+
+// Variable is the value of a variable merged from
+// the layers with the source of the value
+type Variable struct {
+	Name   string
+	Value  interface{}
+	Source string
+}
+
+////////// DEFINITION OF ALL FUNCTIONS ///////////////////////////
+
+// JobVariables returns the variables of the job executed on the
+// host given, merged from all layers except task vars. They are
+// available in templates as .context.variables
+func (f *Flow) JobVariables(j *Job, host string) map[string]interface{} {
+	return mergeVarLayers(f.VarLayers(j, host))
+}
+
+// VarLayers returns the layers of variables of the job on the
+// host given, from the lowest precedence to the highest
+func (f *Flow) VarLayers(j *Job, host string) []VarLayer {
+	layers := f.hostVarLayers(host)
+
+	layers = append(layers, VarLayer{Source: "flow", Vars: f.Variables})
+	layers = append(layers, VarLayer{Source: "job " + j.Name, Vars: j.Variables})
+
+	return append(layers, f.ExtraVars...)
+}
+
+// Variables returns the variables merged from the layers given,
+// sorted by name, with the source of their value. The source of a
+// value is the lowest layer defining it and not overridden afterwards
+func Variables(layers []VarLayer) []Variable {
+	merged := mergeVarLayers(layers)
+	vars := []Variable{}
+
+	for name, value := range merged {
+		source := ""
+
+		for i := len(layers) - 1; i >= 0; i-- {
+			v, ok := layers[i].Vars[name]
+			if !ok {
+				continue
+			}
+
+			if !reflect.DeepEqual(v, value) {
+				break
+			}
+
+			source = layers[i].Source
+		}
+
+		vars = append(vars, Variable{Name: name, Value: value, Source: source})
+	}
+
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].Name < vars[j].Name
+	})
+
+	return vars
+}
+
+// PrintVariables prints the variables of each job on each of its hosts
+// with the source of their value. Secret values are masked
+func (f *Flow) PrintVariables(w io.Writer) error {
+	err := f.registerSecrets()
+	if err != nil {
+		return err
+	}
+
+	for _, j := range f.Jobs {
+		hosts, err := f.jobHosts(j)
+		if err != nil {
+			return fmt.Errorf("job %s: %v", j.Name, err)
+		}
+
+		for _, host := range hosts {
+			fmt.Fprintf(w, "job %s on %s:\n", j.Name, host)
+
+			for _, v := range Variables(f.VarLayers(j, host)) {
+				fmt.Fprintf(w, "  %s = %v (%s)\n", v.Name, MaskValue(v.Value), v.Source)
+			}
+
+			for _, task := range j.AllTasks() {
+				for _, v := range Variables([]VarLayer{{Source: "task " + task.Name, Vars: task.Vars}}) {
+					fmt.Fprintf(w, "  %s = %v (%s)\n", v.Name, MaskValue(v.Value), v.Source)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+//////////////// INTERNAL FUNCTIONS ////////////////////
+
+// hostVarLayers returns the layers of the inventory variables of the
+// host. Vars of an inventory host already contain the vars of its groups
+// and the global ones, overridden by its own. Groups of a host are sorted
+// by precedence when the inventory is read
+func (f *Flow) hostVarLayers(host string) []VarLayer {
+	if f.Inventory == nil {
+		return nil
+	}
+
+	layers := []VarLayer{{Source: "inventory global", Vars: f.Inventory.Global}}
+
+	h, ok := f.Inventory.Hosts[host]
+	if !ok {
+		return layers
+	}
+
+	for _, name := range h.Groups {
+		if g, ok := f.Inventory.Groups[name]; ok {
+			layers = append(layers, VarLayer{Source: "group " + name, Vars: g.Vars})
+		}
+	}
+
+	return append(layers, VarLayer{Source: "host " + host, Vars: h.Vars})
+}
+
+// extraVars returns the variables of the vars files and of the
+// command line which override all others, including task vars
+func (f *Flow) extraVars() map[string]interface{} {
+	return mergeVarLayers(f.ExtraVars)
+}
+
+// mergeVarLayers merges the variables of the layers
+// in their order, the last ones overriding the first
+func mergeVarLayers(layers []VarLayer) map[string]interface{} {
+	vars := make(map[string]interface{})
+
+	for _, l := range layers {
+		for k, v := range l.Vars {
+			vars[k] = v
+		}
+	}
+
+	return vars
+}
+
+// taskVariables returns the variables of the job overridden by
+// the task vars, themselves overridden by the extra variables
+func (job *Job) taskVariables(task *Task, vars map[string]interface{}) map[string]interface{} {
+	if task == nil || len(task.Vars) == 0 {
+		return vars
+	}
+
+	return mergeVarLayers([]VarLayer{
+		{Vars: vars},
+		{Vars: task.Vars},
+		{Vars: job.ExtraVars},
+	})
+}
@@ -0,0 +1,112 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVariablePrecedence(t *testing.T) {
+	inventory := NewInventory()
+	inventory.Global = map[string]interface{}{"a": "global", "b": "global", "c": "global"}
+	inventory.Groups["web"] = Group{Name: "web", Hosts: []string{"localhost"}, Vars: map[string]interface{}{"b": "group", "c": "group"}}
+	inventory.Hosts["localhost"] = Host{
+		Name:   "localhost",
+		Groups: []string{"web"},
+		Vars:   map[string]interface{}{"a": "global", "b": "group", "c": "host"},
+	}
+
+	var params map[string]interface{}
+
+	get := func(ctx context.Context, m map[string]interface{}) *CmdResult {
+		params = m
+		return NewCmdResult()
+	}
+
+	j := NewJob("job1")
+	j.Variables = map[string]interface{}{"e": "job", "f": "job", "g": "job"}
+	j.AddTask(&Task{
+		Name: "task1",
+		Cmd:  Cmd{Func: get},
+		Vars: map[string]interface{}{"f": "task", "g": "task"},
+		Params: map[string]interface{}{
+			"a": "{{ .context.variables.a }}",
+			"b": "{{ .context.variables.b }}",
+			"c": "{{ .context.variables.c }}",
+			"d": "{{ .context.variables.d }}",
+			"e": "{{ .context.variables.e }}",
+			"f": "{{ .context.variables.f }}",
+			"g": "{{ .context.variables.g }}",
+		},
+	})
+
+	f := NewFlow()
+	f.OnOutput = nil
+	f.Inventory = inventory
+	f.Variables = map[string]interface{}{"c": "flow", "d": "flow", "e": "flow"}
+	f.ExtraVars = []VarLayer{
+		{Source: "vars file vars.yml", Vars: map[string]interface{}{"g": "file", "h": "file"}},
+		{Source: "--var", Vars: map[string]interface{}{"h": "cli"}},
+	}
+	f.Jobs = []*Job{j}
+
+	err := f.RunAllJobs()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"a": "global",
+		"b": "group",
+		"c": "flow",
+		"d": "flow",
+		"e": "job",
+		"f": "task",
+		"g": "file",
+	}, params)
+
+	sources := make(map[string]string)
+	for _, v := range Variables(f.VarLayers(j, "localhost")) {
+		sources[v.Name] = v.Source
+	}
+
+	assert.Equal(t, map[string]string{
+		"a": "inventory global",
+		"b": "group web",
+		"c": "flow",
+		"d": "flow",
+		"e": "job job1",
+		"f": "job job1",
+		"g": "vars file vars.yml",
+		"h": "--var",
+	}, sources)
+
+	var buf bytes.Buffer
+	assert.Nil(t, f.PrintVariables(&buf))
+	assert.Contains(t, buf.String(), "job job1 on localhost:\n  a = global (inventory global)\n")
+	assert.Contains(t, buf.String(), "  f = task (task task1)\n")
+}
+
+func TestGenerateRemoteFlowVariables(t *testing.T) {
+	inventory := NewInventory()
+	inventory.Hosts["web1"] = Host{Name: "web1", Vars: map[string]interface{}{"region": "eu", "env": "host"}}
+
+	j := NewJob("job1")
+	j.Hosts = "web1"
+	j.AddTask(&Task{
+		Name: "task1",
+		Cmd:  Cmd{Name: "cmd", Plugin: Plugin{Name: "plugin"}},
+		Vars: map[string]interface{}{"port": 80},
+	})
+
+	f := NewFlow()
+	f.Inventory = inventory
+	f.Variables = map[string]interface{}{"env": "flow"}
+	f.ExtraVars = []VarLayer{{Source: "--var", Vars: map[string]interface{}{"version": "1.0"}}}
+
+	content, err := f.generateLocalFlowRemoteMachine(j)
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "region: eu")
+	assert.Contains(t, string(content), "env: flow")
+	assert.Contains(t, string(content), "extra_vars:\n  version: \"1.0\"")
+	assert.Contains(t, string(content), "vars:\n      port: 80")
+}
@@ -7,4 +7,6 @@ import (
 	_ "github.com/uthng/jobflow/plugins/gox"
 	// Enable plugin github
 	_ "github.com/uthng/jobflow/plugins/github"
+	// Enable plugin facts
+	_ "github.com/uthng/jobflow/plugins/facts"
 )
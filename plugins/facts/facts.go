@@ -0,0 +1,53 @@
+package facts
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uthng/jobflow/job"
+)
+
+var plugin = job.Plugin{
+	Name:        "facts",
+	Version:     "0.1",
+	Description: "Set facts in job context",
+}
+
+// List of available commands for this plugin
+var commands = []job.Cmd{
+	{
+		Name:   "set",
+		Func:   CmdSet,
+		Plugin: plugin,
+
+		// Facts are set in check mode too for next tasks
+		SupportsCheck: true,
+	},
+}
+
+// Init initializes plugin by registering all its commands
+// to command registry
+func init() {
+	for _, cmd := range commands {
+		job.CmdRegister(cmd)
+	}
+}
+
+// CmdSet sets all params as facts. They are available to
+// next tasks under .context.facts
+func CmdSet(ctx context.Context, params map[string]interface{}) *job.CmdResult {
+	var res = job.NewCmdResult()
+
+	if len(params) == 0 {
+		res.Error = fmt.Errorf("no fact to set")
+		return res
+	}
+
+	res.Facts = make(map[string]interface{})
+	for k, v := range params {
+		res.Facts[k] = v
+		res.Result[k] = v
+	}
+
+	return res
+}
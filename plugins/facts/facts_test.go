@@ -0,0 +1,22 @@
+package facts
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCmdSet(t *testing.T) {
+	res := CmdSet(context.Background(), map[string]interface{}{
+		"version": "1.0.0",
+		"build":   42,
+	})
+
+	assert.Nil(t, res.Error)
+	assert.Equal(t, map[string]interface{}{"version": "1.0.0", "build": 42}, res.Facts)
+	assert.Equal(t, "1.0.0", res.Result["version"])
+
+	res = CmdSet(context.Background(), map[string]interface{}{})
+	assert.NotNil(t, res.Error)
+}
@@ -11,7 +11,6 @@ import (
 	"time"
 
 	"github.com/google/go-github/github"
-	"github.com/spf13/cast"
 	"golang.org/x/oauth2"
 
 	log "github.com/uthng/golog"
@@ -65,6 +64,8 @@ type client struct {
 	//soft       bool
 
 	dryRun bool
+	// planned contains the actions not performed in dry run
+	planned []string
 
 	repositories repositoriesService
 	git          gitService
@@ -83,15 +84,54 @@ var plugin = job.Plugin{
 	Description: "Github operations: release, changelog etc.",
 }
 
+// releaseParams is the specification of release params
+var releaseParams = []job.Param{
+	{Name: "token", Type: job.ParamString, Required: true, Description: "github api token"},
+	{Name: "user", Type: job.ParamString, Required: true, Description: "github user"},
+	{Name: "repository", Type: job.ParamString, Required: true, Description: "repository name"},
+	{Name: "version", Type: job.ParamString, Required: true, Description: "tag name"},
+	{Name: "commitish", Type: job.ParamString, Required: true, Description: "branch name or commit SHA"},
+	{Name: "name", Type: job.ParamString, Required: true, Description: "release name"},
+	{Name: "description", Type: job.ParamString, Default: "changelog", Description: "\"changelog\" or release description"},
+	{Name: "changelog", Type: job.ParamBool, Default: true, Description: "generate changelog"},
+	{Name: "changelog_type", Type: job.ParamInt, Default: COMMIT, Enum: []interface{}{COMMIT, ISSUE}, Description: "0 = commit, 1 = issue"},
+	{Name: "assets", Type: job.ParamList, Description: "paths to files to upload to the release"},
+	{Name: "draft", Type: job.ParamBool, Default: false, Description: "just a draft and no publish"},
+	{Name: "prerelease", Type: job.ParamBool, Default: false, Description: "mark release as prerelease"},
+	{Name: "replace", Type: job.ParamBool, Default: false, Description: "replace assets already uploaded"},
+	{Name: "dry_run", Type: job.ParamBool, Default: false, Description: "only display messages, no action performed"},
+}
+
 // List of available commands for this plugin
 var commands = []job.Cmd{
 	{
 		Name:   "release",
 		Func:   CmdRelease,
 		Plugin: plugin,
+		Params: releaseParams,
+
+		SupportsCheck: true,
 	},
 }
 
+// releaseOptions contains the params of release decoded
+type releaseOptions struct {
+	Token         string   `param:"token"`
+	User          string   `param:"user"`
+	Repository    string   `param:"repository"`
+	Version       string   `param:"version"`
+	Commitish     string   `param:"commitish"`
+	Name          string   `param:"name"`
+	Description   string   `param:"description"`
+	Changelog     bool     `param:"changelog"`
+	ChangelogType int      `param:"changelog_type"`
+	Assets        []string `param:"assets"`
+	Draft         bool     `param:"draft"`
+	Prerelease    bool     `param:"prerelease"`
+	Replace       bool     `param:"replace"`
+	DryRun        bool     `param:"dry_run"`
+}
+
 // Init initializes plugin by registering all its commands
 // to command registry
 func init() {
@@ -115,151 +155,50 @@ func init() {
 // - assets: list of string paths to files to upload to the release. Default: empty array
 // - draft: true/false. Just a draft and no publish
 // - prerelease: true/false
-// - delete: true/false. Delete release and its git tag in advance if it exists
 // - replace: replace artifacts if it is already uploaded
-// - soft: true/false. Stop uploading if the same tag already exists
 // - dry_run: true/false. Only display messages, not action performed. Default: false
-func CmdRelease(params map[string]interface{}) *job.CmdResult {
-	var value interface{}
-	// Repository
+//
+// In check mode, it behaves as in dry run. Actions not performed
+// are returned as planned actions.
+//
+// All github API calls are cancelled when the context is done.
+func CmdRelease(ctx context.Context, params map[string]interface{}) *job.CmdResult {
 	var result = job.NewCmdResult()
-	var token string
-
-	var user string
-	var repository string
-	var version string
-	var commitish string
-
-	// Release
-	var name string
-	var description = "changelog"
-
-	// Changelog
-	var changelog = true
-	var changelogType = 0
-
-	// Assets
-	var assets = []string{}
-
-	// Options
-	var draft = false
-	var prerelease = false
-	//var delete = false
-	var replace = false
-	//var soft = false
-
-	var dryRun = false
-
-	value, ok := params["token"]
-	if ok == false {
-		result.Error = fmt.Errorf("param token missing")
-		return result
-	}
-	token = cast.ToString(value)
-
-	value, ok = params["user"]
-	if ok == false {
-		result.Error = fmt.Errorf("param user missing")
-		return result
-	}
-	user = cast.ToString(value)
-
-	value, ok = params["repository"]
-	if ok == false {
-		result.Error = fmt.Errorf("param repository missing")
-		return result
-	}
-	repository = cast.ToString(value)
-
-	value, ok = params["version"]
-	if ok == false {
-		result.Error = fmt.Errorf("param version missing")
-		return result
-	}
-	version = cast.ToString(value)
-
-	value, ok = params["commitish"]
-	if ok == false {
-		result.Error = fmt.Errorf("param commit missing")
-		return result
-	}
-	commitish = cast.ToString(value)
+	var opts = releaseOptions{Assets: []string{}}
 
-	value, ok = params["name"]
-	if ok == false {
-		result.Error = fmt.Errorf("param name missing")
+	err := job.DecodeParams(params, releaseParams, &opts)
+	if err != nil {
+		result.Error = err
 		return result
 	}
-	name = cast.ToString(value)
-
-	value, ok = params["description"]
-	if ok {
-		description = cast.ToString(value)
-	}
-
-	value, ok = params["changelog"]
-	if ok {
-		changelog = cast.ToBool(value)
-	}
-
-	value, ok = params["changelog_type"]
-	if ok {
-		changelogType = cast.ToInt(value)
-	}
-
-	value, ok = params["assets"]
-	if ok {
-		assets = cast.ToStringSlice(value)
-	}
-
-	value, ok = params["draft"]
-	if ok {
-		draft = cast.ToBool(value)
-	}
-
-	value, ok = params["prerelease"]
-	if ok {
-		prerelease = cast.ToBool(value)
-	}
-
-	value, ok = params["replace"]
-	if ok {
-		replace = cast.ToBool(value)
-	}
-
-	value, ok = params["dry_run"]
-	if ok {
-		dryRun = cast.ToBool(value)
-	}
 
-	client := newClientByToken(token)
+	client := newClientByToken(ctx, opts.Token)
 	// repository
-	client.user = user
-	client.repository = repository
-	client.tag = version
-	client.commitish = commitish
+	client.user = opts.User
+	client.repository = opts.Repository
+	client.tag = opts.Version
+	client.commitish = opts.Commitish
 
 	// Release
-	client.name = name
-	client.description = description
+	client.name = opts.Name
+	client.description = opts.Description
 
 	// Changelog
-	client.changelog = changelog
-	client.changelogType = changelogType
+	client.changelog = opts.Changelog
+	client.changelogType = opts.ChangelogType
 
 	// Assets
-	client.assets = assets
+	client.assets = opts.Assets
 
 	// Options
-	client.draft = draft
-	client.prerelease = prerelease
-	//client.delete = delete
-	client.replace = replace
-	//client.soft = soft
+	client.draft = opts.Draft
+	client.prerelease = opts.Prerelease
+	client.replace = opts.Replace
 
-	client.dryRun = dryRun
+	client.dryRun = opts.DryRun || job.IsCheckMode(ctx)
 
 	release, err := client.createRelease()
+	result.Planned = client.planned
 	if err != nil {
 		log.Errorw("Error while creating new release", "version", client.tag, "commitish", client.commitish)
 		result.Error = err
@@ -275,9 +214,9 @@ func CmdRelease(params map[string]interface{}) *job.CmdResult {
 
 // newClientByToken returns a new github client with context
 // using github token
-func newClientByToken(token string) *client {
+func newClientByToken(ctx context.Context, token string) *client {
 	c := &client{
-		ctx: context.Background(),
+		ctx: ctx,
 	}
 
 	ts := oauth2.StaticTokenSource(
@@ -381,7 +320,7 @@ func (c *client) createRelease() (*github.RepositoryRelease, error) {
 			}
 
 			if c.dryRun {
-				log.Infoln("Deleting release: ", wantedRelease.GetID(), ", ", wantedRelease.GetName())
+				c.plan("delete release %d: %s", wantedRelease.GetID(), wantedRelease.GetName())
 			} else {
 				_, err = c.repositories.DeleteRelease(c.ctx, c.user, c.repository, *wantedRelease.ID)
 				if err != nil {
@@ -402,7 +341,7 @@ func (c *client) createRelease() (*github.RepositoryRelease, error) {
 	// Remove ref tag
 	if wantedRefTag != nil {
 		if c.dryRun {
-			log.Infoln("Deleting ref:", "refs/tags/"+c.tag)
+			c.plan("delete ref refs/tags/%s", c.tag)
 		} else {
 			_, err := c.git.DeleteRef(c.ctx, c.user, c.repository, "refs/tags/"+c.tag)
 			if err != nil {
@@ -467,7 +406,7 @@ func (c *client) createRelease() (*github.RepositoryRelease, error) {
 	}
 
 	if c.dryRun {
-		log.Infof("Creating new ref: %+v\n", newRefTag)
+		c.plan("create ref %s on commit %s", refTag, commit.GetSHA())
 	} else {
 		_, _, err = c.git.CreateRef(c.ctx, c.user, c.repository, newRefTag)
 		if err != nil {
@@ -488,7 +427,7 @@ func (c *client) createRelease() (*github.RepositoryRelease, error) {
 
 	var r *github.RepositoryRelease
 	if c.dryRun {
-		log.Infof("Creating release: %+v\n", newRelease)
+		c.plan("create release %s (tag %s, commitish %s, draft %t, prerelease %t)", c.name, c.tag, c.commitish, c.draft, c.prerelease)
 	} else {
 		r, _, err = c.repositories.CreateRelease(c.ctx, c.user, c.repository, newRelease)
 		if err != nil {
@@ -509,6 +448,12 @@ func (c *client) createRelease() (*github.RepositoryRelease, error) {
 // uploadAssets loops asset list and upload one by one to release
 func (c *client) uploadAssets(releaseID int64) error {
 	for _, asset := range c.assets {
+		// Assets may not be built yet in dry run
+		if c.dryRun {
+			c.plan("upload asset %s", asset)
+			continue
+		}
+
 		f, err := os.Open(asset)
 		if err != nil {
 			log.Errorw("Cannot open the asset file", "asset", asset, "err", err)
@@ -518,15 +463,11 @@ func (c *client) uploadAssets(releaseID int64) error {
 		splits := strings.Split(asset, "/")
 		assetName := splits[len(splits)-1]
 		// Upload asset
-		if c.dryRun {
-			log.Infoln("Uploading asset file:", asset)
-		} else {
-			_, _, err = c.repositories.UploadReleaseAsset(c.ctx, c.user, c.repository, releaseID, &github.UploadOptions{Name: assetName}, f)
-			if err != nil {
-				log.Errorw("Cannot upload the asset file", "asset", asset, "release", releaseID, "err", err)
-				f.Close()
-				return err
-			}
+		_, _, err = c.repositories.UploadReleaseAsset(c.ctx, c.user, c.repository, releaseID, &github.UploadOptions{Name: assetName}, f)
+		if err != nil {
+			log.Errorw("Cannot upload the asset file", "asset", asset, "release", releaseID, "err", err)
+			f.Close()
+			return err
 		}
 
 		f.Close()
@@ -547,7 +488,7 @@ func (c *client) deleteAssets(releaseID int64) error {
 	// Loop to remove all assets
 	for _, asset := range assets {
 		if c.dryRun {
-			log.Infoln("Deleting release asset: ", asset.GetID, ", ", asset.GetName())
+			c.plan("delete release asset %d: %s", asset.GetID(), asset.GetName())
 		} else {
 			_, err = c.repositories.DeleteReleaseAsset(c.ctx, c.user, c.repository, *asset.ID)
 			if err != nil {
@@ -560,6 +501,14 @@ func (c *client) deleteAssets(releaseID int64) error {
 	return nil
 }
 
+// plan records an action not performed in dry run
+func (c *client) plan(format string, args ...interface{}) {
+	action := fmt.Sprintf(format, args...)
+	log.Infow("Dry run", "action", action)
+
+	c.planned = append(c.planned, action)
+}
+
 // formatCommitChangelog parses commit message to build a changelog message
 // with the following format: [<scope>:] <subject> <sha>, [issues...]
 //
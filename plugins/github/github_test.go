@@ -353,10 +353,56 @@ func TestGenerateChangeLog(t *testing.T) {
 func TestCreateRelease(t *testing.T) {
 	ctx := context.Background()
 
+	repositories := &fakeClient{
+		commits: []*commit{
+			{
+				sha:     "364b53e7abf3b56b8e984c55ce9bebef8ee016eb",
+				message: "feat(core): subject 1\n\nBody1\n\nClosed #1, resolved #500",
+				date:    time.Date(2018, time.November, 5, 10, 0, 0, 0, time.UTC),
+			},
+			{
+				sha:     "989b53e7abf3b56b8e984c55ce9bebef8ee016eb",
+				message: "fix: subject 2 (#1234)\n\nBody2\n\nFixed #2, fix #120",
+				date:    time.Date(2018, time.November, 10, 10, 0, 0, 0, time.UTC),
+			},
+			{
+				sha:     "111b53e7abf3b56b8e984c55ce9bebef8ee016eb",
+				message: "fix: subject 21\n\nBody21\n\nFixed #21",
+				date:    time.Date(2018, time.November, 11, 10, 0, 0, 0, time.UTC),
+			},
+			{
+				sha:     "197b53e7abf3b56b8e984c55ce9bebef8ee016eb",
+				message: "Subject 3\n\nBody3\n\nClosed #3, fixed ex_repo/ex_user#234, fixes #200",
+				date:    time.Date(2018, time.November, 15, 10, 0, 0, 0, time.UTC),
+			},
+		},
+		releases: []*release{
+			{
+				tag:       "0.2.0",
+				commitish: "989b53e7abf3b56b8e984c55ce9bebef8ee016eb",
+				createAt:  time.Date(2018, time.November, 10, 10, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	git := &fakeClient{
+		tags: []*tag{
+			{
+				ref: "refs/tags/0.1.9",
+				sha: "555b53e7abf3b56b8e984c55ce9bebef8ee016eb",
+			},
+			{
+				ref: "refs/tags/0.2.0",
+				sha: "989b53e7abf3b56b8e984c55ce9bebef8ee016eb",
+			},
+		},
+	}
+
 	testCases := []struct {
 		name    string
 		client  *client
 		release *github.RepositoryRelease
+		planned []string
 	}{
 		{
 			"NoRelease_TypeCommitOK",
@@ -367,49 +413,8 @@ func TestCreateRelease(t *testing.T) {
 				name:          "0.2.1",
 				changelog:     true,
 				changelogType: COMMIT,
-				repositories: &fakeClient{
-					commits: []*commit{
-						{
-							sha:     "364b53e7abf3b56b8e984c55ce9bebef8ee016eb",
-							message: "feat(core): subject 1\n\nBody1\n\nClosed #1, resolved #500",
-							date:    time.Date(2018, time.November, 5, 10, 0, 0, 0, time.UTC),
-						},
-						{
-							sha:     "989b53e7abf3b56b8e984c55ce9bebef8ee016eb",
-							message: "fix: subject 2 (#1234)\n\nBody2\n\nFixed #2, fix #120",
-							date:    time.Date(2018, time.November, 10, 10, 0, 0, 0, time.UTC),
-						},
-						{
-							sha:     "111b53e7abf3b56b8e984c55ce9bebef8ee016eb",
-							message: "fix: subject 21\n\nBody21\n\nFixed #21",
-							date:    time.Date(2018, time.November, 11, 10, 0, 0, 0, time.UTC),
-						},
-						{
-							sha:     "197b53e7abf3b56b8e984c55ce9bebef8ee016eb",
-							message: "Subject 3\n\nBody3\n\nClosed #3, fixed ex_repo/ex_user#234, fixes #200",
-							date:    time.Date(2018, time.November, 15, 10, 0, 0, 0, time.UTC),
-						},
-					},
-					releases: []*release{
-						{
-							tag:       "0.2.0",
-							commitish: "989b53e7abf3b56b8e984c55ce9bebef8ee016eb",
-							createAt:  time.Date(2018, time.November, 10, 10, 0, 0, 0, time.UTC),
-						},
-					},
-				},
-				git: &fakeClient{
-					tags: []*tag{
-						{
-							ref: "refs/tags/0.1.9",
-							sha: "555b53e7abf3b56b8e984c55ce9bebef8ee016eb",
-						},
-						{
-							ref: "refs/tags/0.2.0",
-							sha: "989b53e7abf3b56b8e984c55ce9bebef8ee016eb",
-						},
-					},
-				},
+				repositories:  repositories,
+				git:           git,
 			},
 			&github.RepositoryRelease{
 				TagName:         getPtrString("0.2.1"),
@@ -419,6 +424,28 @@ func TestCreateRelease(t *testing.T) {
 				Draft:           getPtrBool(false),
 				Prerelease:      getPtrBool(false),
 			},
+			nil,
+		},
+		{
+			"NoRelease_DryRun",
+			&client{
+				ctx:           ctx,
+				tag:           "0.2.1",
+				commitish:     "197b53e7abf3b56b8e984c55ce9bebef8ee016eb",
+				name:          "0.2.1",
+				changelog:     true,
+				changelogType: COMMIT,
+				assets:        []string{"bin/jobflow"},
+				dryRun:        true,
+				repositories:  repositories,
+				git:           git,
+			},
+			nil,
+			[]string{
+				"create ref refs/tags/0.2.1 on commit 197b53e7abf3b56b8e984c55ce9bebef8ee016eb",
+				"create release 0.2.1 (tag 0.2.1, commitish 197b53e7abf3b56b8e984c55ce9bebef8ee016eb, draft false, prerelease false)",
+				"upload asset bin/jobflow",
+			},
 		},
 	}
 
@@ -429,6 +456,7 @@ func TestCreateRelease(t *testing.T) {
 
 			assert.Nil(t, err)
 			assert.Equal(t, tc.release, release)
+			assert.Equal(t, tc.planned, tc.client.planned)
 		})
 	}
 }
@@ -2,27 +2,43 @@ package gox
 
 import "C"
 import (
-	"fmt"
+	"bytes"
+	"context"
+	"io"
 	"os/exec"
 	"strings"
+	"sync"
 
-	"github.com/spf13/cast"
 	log "github.com/uthng/golog"
 	"github.com/uthng/jobflow/job"
 )
 
+// lockedBuffer is a buffer in which stdout & stderr
+// can be written at the same time
+type lockedBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
 var plugin = job.Plugin{
 	Name:        "gox",
 	Version:     "0.1",
 	Description: "Use gox to build multiple platforms",
 }
 
+// buildParams is the specification of build params
+var buildParams = []job.Param{
+	{Name: "osarch", Type: job.ParamList, Required: true, Description: "list of os/arch to build"},
+	{Name: "output", Type: job.ParamString, Required: true, Description: "output path template"},
+}
+
 // List of available commands for this plugin
 var commands = []job.Cmd{
 	{
 		Name:   "build",
 		Func:   CmdBuild,
 		Plugin: plugin,
+		Params: buildParams,
 	},
 }
 
@@ -35,43 +51,65 @@ func init() {
 }
 
 // CmdBuild compiles multiple platforms.
-// It takes a map of params
-func CmdBuild(params map[string]interface{}) *job.CmdResult {
+// It takes a map of params. The build is killed
+// when the context is done.
+func CmdBuild(ctx context.Context, params map[string]interface{}) *job.CmdResult {
 	var res = job.NewCmdResult()
 	var args []string
+	var opts struct {
+		OSArch []string `param:"osarch"`
+		Output string   `param:"output"`
+	}
 
-	args = append(args, "gox")
-
-	value, ok := params["osarch"]
-	if ok == false {
-		res.Error = fmt.Errorf("param osarch missing")
+	err := job.DecodeParams(params, buildParams, &opts)
+	if err != nil {
+		res.Error = err
 		return res
 	}
-	v := cast.ToStringSlice(value)
-	oa := "-osarch=\"" + strings.Join(v, " ") + "\""
+
+	args = append(args, "gox")
+
+	oa := "-osarch=\"" + strings.Join(opts.OSArch, " ") + "\""
 	args = append(args, oa)
 
-	value, ok = params["output"]
-	if ok == false {
-		res.Error = fmt.Errorf("param output missing")
-		return res
-	}
-	o := "-output=\"" + cast.ToString(value) + "\""
+	o := "-output=\"" + opts.Output + "\""
 	args = append(args, o)
 
 	log.Debugw("Executing command", "args", args)
 
 	// Execute kubectl command
-	cmd := exec.Command(args[0], args[1:len(args)]...)
-	//cmd := exec.CommandContext(ctx, "gox", args)
+	cmd := exec.CommandContext(ctx, args[0], args[1:len(args)]...)
+
+	// Stream output while keeping it. Stdout & stderr
+	// are combined in the result as before
+	out := job.OutputFromContext(ctx)
+	combined := &lockedBuffer{}
+	cmd.Stdout = io.MultiWriter(out.Stdout, combined)
+	cmd.Stderr = io.MultiWriter(out.Stderr, combined)
 
 	// Check if error
-	output, err := cmd.CombinedOutput()
+	err = cmd.Run()
 	if err != nil {
 		res.Error = err
 		return res
 	}
 
-	res.Result["result"] = string(output)
+	res.Result["result"] = combined.String()
 	return res
 }
+
+// Write adds data to the buffer
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.buf.Write(p)
+}
+
+// String returns data written
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.buf.String()
+}
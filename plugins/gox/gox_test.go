@@ -1,6 +1,7 @@
 package gox_test
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -40,7 +41,7 @@ func TestCmdBuild(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			result := gox.CmdBuild(tc.params)
+			result := gox.CmdBuild(context.Background(), tc.params)
 			assert.Equal(t, result, tc.result)
 		})
 	}
@@ -2,7 +2,7 @@ package shell
 
 import "C"
 import (
-	"fmt"
+	"context"
 	"os/exec"
 	//"strings"
 
@@ -15,12 +15,18 @@ var plugin = job.Plugin{
 	Description: "Everything concern shell",
 }
 
+// execParams is the specification of exec params
+var execParams = []job.Param{
+	{Name: "cmd", Type: job.ParamString, Required: true, Description: "command executed by bash"},
+}
+
 // List of available commands for this plugin
 var commands = []job.Cmd{
 	{
 		Name:   "exec",
 		Func:   ExecCmd,
 		Plugin: plugin,
+		Params: execParams,
 	},
 }
 
@@ -33,30 +39,46 @@ func init() {
 }
 
 // ExecCmd executes a command shell (bash).
-// It takes a map of params
-func ExecCmd(params map[string]interface{}) *job.CmdResult {
+// It takes a map of params. The shell is killed
+// when the context is done. Its stdout and stderr
+// are streamed to the command output.
+func ExecCmd(ctx context.Context, params map[string]interface{}) *job.CmdResult {
 	//var command []string
 	var res = job.NewCmdResult()
 
-	value, ok := params["cmd"]
-	if ok == false {
-		res.Error = fmt.Errorf("param pkgname missing")
+	var opts struct {
+		Cmd string `param:"cmd"`
+	}
+
+	err := job.DecodeParams(params, execParams, &opts)
+	if err != nil {
+		res.Error = err
 		return res
 	}
 	//command = strings.Fields(value.(string))
-	command := value.(string)
+	command := opts.Cmd
 
 	// Execute kubectl command
 	//cmd := exec.Command(command[0], command[1:len(command)]...)
-	cmd := exec.Command("bash", "-c", command)
+	cmd := exec.CommandContext(ctx, "bash", "-c", command)
+
+	// Stream stdout & stderr while keeping them
+	out := job.OutputFromContext(ctx)
+	cmd.Stdout = out.Stdout
+	cmd.Stderr = out.Stderr
 
 	// Check if error
-	output, err := cmd.Output()
+	err = cmd.Run()
+
+	res.Result["result"] = out.StdoutString()
+	if stderr := out.StderrString(); stderr != "" {
+		res.Result["stderr"] = stderr
+	}
+
 	if err != nil {
 		res.Error = err
 		return res
 	}
 
-	res.Result["result"] = string(output)
 	return res
 }
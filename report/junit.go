@@ -0,0 +1,120 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+/////////// DECLARATION OF ALL TYPES //////////////////////////
+
+// junitTestSuites is the root element of a JUnit report.
+// There is a test suite per job and host and a test case per task.
+type junitTestSuites struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Name     string            `xml:"name,attr"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Skipped  int               `xml:"skipped,attr"`
+	Time     string            `xml:"time,attr"`
+	Suites   []*junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string           `xml:"name,attr"`
+	Hostname string           `xml:"hostname,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Cases    []*junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+//////////////// INTERNAL FUNCTIONS ////////////////////
+
+// writeJUnit writes the report in JUnit XML
+func (r *Report) writeJUnit(w io.Writer) error {
+	suites := &junitTestSuites{
+		Name: "jobflow",
+		Time: junitTime(r.Duration),
+	}
+
+	for _, j := range r.Jobs {
+		suite := &junitTestSuite{
+			Name:     j.Name + "@" + j.Host,
+			Hostname: j.Host,
+			Time:     junitTime(j.Duration),
+		}
+
+		for _, t := range j.Tasks {
+			suite.addCase(j.Name, t.Name, t.Status, t.Error, t.Duration)
+		}
+
+		// A job failed or skipped without task results, for example when
+		// its host is unreachable, is reported as a test case itself
+		if len(j.Tasks) == 0 && j.Status != StatusSuccess {
+			suite.addCase(j.Name, j.Name, j.Status, j.Error, j.Duration)
+		}
+
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Skipped += suite.Skipped
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	err = enc.Encode(suites)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+
+	return err
+}
+
+// addCase adds a test case with the status given to the test suite
+func (s *junitTestSuite) addCase(job, name, status, err string, d time.Duration) {
+	tc := &junitTestCase{
+		Name:      name,
+		Classname: job + "." + s.Hostname,
+		Time:      junitTime(d),
+	}
+
+	switch status {
+	case StatusFailed:
+		tc.Failure = &junitMessage{Message: err}
+		s.Failures++
+	case StatusSkipped:
+		tc.Skipped = &junitMessage{Message: err}
+		s.Skipped++
+	}
+
+	s.Tests++
+	s.Cases = append(s.Cases, tc)
+}
+
+// junitTime returns a duration in seconds
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
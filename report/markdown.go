@@ -0,0 +1,90 @@
+package report
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+//////////////// INTERNAL FUNCTIONS ////////////////////
+
+// writeMarkdown writes a summary of the report in Markdown with
+// the counts of jobs per status and a table of all tasks
+func (r *Report) writeMarkdown(w io.Writer) error {
+	counts := make(map[string]int)
+	for _, j := range r.Jobs {
+		counts[j.Status]++
+	}
+
+	b := bufio.NewWriter(w)
+
+	fmt.Fprintf(b, "## Jobflow report\n\n")
+	fmt.Fprintf(b, "Status: **%s** in %s\n\n", r.Status, markdownDuration(r.Duration))
+	fmt.Fprintf(b, "Jobs: %d %s, %d %s, %d %s\n\n",
+		counts[StatusSuccess], StatusSuccess, counts[StatusFailed], StatusFailed, counts[StatusSkipped], StatusSkipped)
+
+	fmt.Fprintf(b, "| Host | Job | Task | Status | Duration | Error |\n")
+	fmt.Fprintf(b, "|------|-----|------|--------|----------|-------|\n")
+
+	for _, j := range r.Jobs {
+		// A job without task results, for example when its host
+		// is unreachable, has its own row
+		if len(j.Tasks) == 0 {
+			writeMarkdownRow(b, j.Host, j.Name, "-", j.Status, j.Duration, j.Error)
+			continue
+		}
+
+		for _, t := range j.Tasks {
+			writeMarkdownRow(b, j.Host, j.Name, t.Name, t.Status, t.Duration, t.Error)
+		}
+	}
+
+	writeMarkdownPlanned(b, r)
+
+	return b.Flush()
+}
+
+// writeMarkdownPlanned writes the list of actions planned
+// by each task in check mode
+func writeMarkdownPlanned(w io.Writer, r *Report) {
+	header := false
+
+	for _, j := range r.Jobs {
+		for _, t := range j.Tasks {
+			if len(t.Planned) == 0 {
+				continue
+			}
+
+			if !header {
+				fmt.Fprintf(w, "\n### Planned actions\n")
+				header = true
+			}
+
+			fmt.Fprintf(w, "\n**%s / %s / %s**\n\n", j.Host, j.Name, t.Name)
+			for _, action := range t.Planned {
+				fmt.Fprintf(w, "- %s\n", action)
+			}
+		}
+	}
+}
+
+// writeMarkdownRow writes a row of the task table
+func writeMarkdownRow(w io.Writer, host, job, task, status string, d time.Duration, err string) {
+	fmt.Fprintf(w, "| %s | %s | %s | %s | %s | %s |\n",
+		markdownCell(host), markdownCell(job), markdownCell(task), status, markdownDuration(d), markdownCell(err))
+}
+
+// markdownCell escapes the characters breaking a table cell
+func markdownCell(str string) string {
+	str = strings.Replace(str, "|", "\\|", -1)
+	str = strings.Replace(str, "\r", "", -1)
+
+	return strings.Replace(str, "\n", "<br>", -1)
+}
+
+// markdownDuration rounds a duration to be readable
+func markdownDuration(d time.Duration) string {
+	return d.Round(time.Millisecond).String()
+}
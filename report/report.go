@@ -0,0 +1,215 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/uthng/jobflow/job"
+)
+
+/////////// DECLARATION OF ALL TYPES //////////////////////////
+
+const (
+	// FormatJSON is the JSON report
+	FormatJSON = "json"
+	// FormatJUnit is the JUnit XML report
+	FormatJUnit = "junit"
+	// FormatMarkdown is the Markdown summary
+	FormatMarkdown = "markdown"
+)
+
+const (
+	// StatusSuccess is the status of a flow, job or task succeeded
+	StatusSuccess = "success"
+	// StatusFailed is the status of a flow, job or task failed
+	StatusFailed = "failed"
+	// StatusSkipped is the status of a job or task not executed
+	StatusSkipped = "skipped"
+)
+
+// Report is the result of a flow run
+type Report struct {
+	Status   string
+	Duration time.Duration
+	Jobs     []*JobReport
+}
+
+// JobReport is the result of a job on a host
+type JobReport struct {
+	Name         string
+	Host         string
+	Batch        int `json:",omitempty"`
+	Status       string
+	Duration     time.Duration
+	Error        string `json:",omitempty"`
+	CleanupError string `json:",omitempty"`
+	Tasks        []*TaskReport
+}
+
+// TaskReport is the result of a task executed by a job
+type TaskReport struct {
+	Name     string
+	Status   string
+	Duration time.Duration
+	Attempts int      `json:",omitempty"`
+	Error    string   `json:",omitempty"`
+	Planned  []string `json:",omitempty"`
+	Result   map[string]interface{}
+}
+
+////////// DEFINITION OF ALL FUNCTIONS ///////////////////////////
+
+// New creates the report of the last run of the flow
+// from its result.
+//
+// Jobs are sorted by host and keep their execution order
+// on each host. Tasks keep their declaration order.
+func New(f *job.Flow) *Report {
+	r := &Report{
+		Status:   StatusName(f.Status),
+		Duration: f.Duration,
+		Jobs:     []*JobReport{},
+	}
+
+	hosts := []string{}
+	for host := range f.Result {
+		hosts = append(hosts, host)
+	}
+
+	sort.Strings(hosts)
+
+	for _, host := range hosts {
+		for _, j := range f.Result[host] {
+			r.Jobs = append(r.Jobs, newJobReport(j))
+		}
+	}
+
+	return r
+}
+
+// CheckFormat returns an error if the report format is not supported
+func CheckFormat(format string) error {
+	switch format {
+	case FormatJSON, FormatJUnit, FormatMarkdown:
+		return nil
+	}
+
+	return fmt.Errorf("unknown report format %s: must be %s, %s or %s", format, FormatJSON, FormatJUnit, FormatMarkdown)
+}
+
+// Write writes the report in the format given
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatJSON:
+		return r.writeJSON(w)
+	case FormatJUnit:
+		return r.writeJUnit(w)
+	case FormatMarkdown:
+		return r.writeMarkdown(w)
+	}
+
+	return CheckFormat(format)
+}
+
+// StatusName returns the name of a job or task status
+func StatusName(status int) string {
+	switch status {
+	case job.SUCCESS:
+		return StatusSuccess
+	case job.FAILED:
+		return StatusFailed
+	case job.SKIPPED:
+		return StatusSkipped
+	}
+
+	return "unknown"
+}
+
+//////////////// INTERNAL FUNCTIONS ////////////////////
+
+// newJobReport creates the report of a job executed on a host
+func newJobReport(j *job.Job) *JobReport {
+	r := &JobReport{
+		Name:     j.Name,
+		Host:     j.Hosts,
+		Batch:    j.Batch,
+		Status:   StatusName(j.Status),
+		Duration: j.Duration,
+		Tasks:    []*TaskReport{},
+	}
+
+	if j.Error != nil {
+		r.Error = job.MaskSecrets(j.Error.Error())
+	}
+
+	if j.CleanupErr != nil {
+		r.CleanupError = job.MaskSecrets(j.CleanupErr.Error())
+	}
+
+	// Tasks which were not reached have no result
+	for _, task := range j.AllTasks() {
+		res, ok := j.Result[task.Name]
+		if !ok || res == nil {
+			continue
+		}
+
+		r.Tasks = append(r.Tasks, newTaskReport(task.Name, res))
+	}
+
+	return r
+}
+
+// newTaskReport creates the report of a task result
+// in which secret values are masked
+func newTaskReport(name string, res *job.CmdResult) *TaskReport {
+	res = job.MaskResult(res)
+
+	r := &TaskReport{
+		Name:     name,
+		Status:   StatusName(res.Status),
+		Duration: res.Duration,
+		Attempts: res.Attempts,
+		Planned:  res.Planned,
+		Result:   resultValues(res),
+	}
+
+	if res.Error != nil {
+		r.Error = res.Error.Error()
+	}
+
+	// The reason of a task skipped is reported as its error
+	if reason, ok := res.Result["skip_reason"].(string); ok && r.Error == "" {
+		r.Error = reason
+	}
+
+	return r
+}
+
+// writeJSON writes the report in indented JSON
+func (r *Report) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(r)
+}
+
+// resultValues returns the values of a command result which can be
+// encoded in all formats. Maps decoded from YAML are converted
+// by the JSON encoding of the command result.
+func resultValues(res *job.CmdResult) map[string]interface{} {
+	values := struct{ Result map[string]interface{} }{}
+
+	b, err := json.Marshal(&job.CmdResult{Result: res.Result})
+	if err == nil {
+		err = json.Unmarshal(b, &values)
+	}
+
+	if err != nil || values.Result == nil {
+		return map[string]interface{}{}
+	}
+
+	return values.Result
+}
@@ -0,0 +1,156 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/uthng/jobflow/job"
+)
+
+func newTestFlow(t *testing.T) *job.Flow {
+	ok := func(ctx context.Context, m map[string]interface{}) *job.CmdResult {
+		return &job.CmdResult{Result: map[string]interface{}{
+			"map": map[interface{}]interface{}{"key": "value"},
+		}}
+	}
+
+	nok := func(ctx context.Context, m map[string]interface{}) *job.CmdResult {
+		return &job.CmdResult{Error: errors.New("NOK | line1\nline2"), Result: map[string]interface{}{}}
+	}
+
+	task1 := &job.Task{Name: "task1", Cmd: job.Cmd{Func: ok}, OnSuccess: "task2"}
+	task2 := &job.Task{Name: "task2", Cmd: job.Cmd{Func: ok}, When: "false", OnSuccess: "task3"}
+	task3 := &job.Task{Name: "task3", Cmd: job.Cmd{Func: nok}}
+
+	job1 := job.NewJob("job1")
+	job1.AddTask(task1)
+	job1.AddTask(task2)
+	job1.AddTask(task3)
+
+	job2 := job.NewJob("job2")
+	job2.Needs = []string{"job1"}
+	job2.AddTask(&job.Task{Name: "task4", Cmd: job.Cmd{Func: ok}})
+
+	f := job.NewFlow()
+	f.OnOutput = nil
+	f.Jobs = []*job.Job{job1, job2}
+
+	err := f.RunAllJobs()
+	assert.NotNil(t, err)
+
+	// Job failed on a remote host before executing any task
+	remote := job.NewJob("job3")
+	remote.Hosts = "web1"
+	remote.Status = job.FAILED
+	remote.Error = errors.New("host web1 unreachable")
+	f.Result["web1"] = []*job.Job{remote}
+
+	return f
+}
+
+func TestNew(t *testing.T) {
+	r := New(newTestFlow(t))
+
+	assert.Equal(t, StatusFailed, r.Status)
+	assert.True(t, r.Duration > 0)
+	assert.Equal(t, 3, len(r.Jobs))
+
+	job1 := r.Jobs[0]
+	assert.Equal(t, "job1", job1.Name)
+	assert.Equal(t, "localhost", job1.Host)
+	assert.Equal(t, StatusFailed, job1.Status)
+	assert.True(t, job1.Duration > 0)
+	assert.Equal(t, 3, len(job1.Tasks))
+
+	assert.Equal(t, "task1", job1.Tasks[0].Name)
+	assert.Equal(t, StatusSuccess, job1.Tasks[0].Status)
+	assert.Equal(t, map[string]interface{}{"map": map[string]interface{}{"key": "value"}}, job1.Tasks[0].Result)
+	assert.Equal(t, StatusSkipped, job1.Tasks[1].Status)
+	assert.Equal(t, StatusFailed, job1.Tasks[2].Status)
+	assert.Equal(t, "NOK | line1\nline2", job1.Tasks[2].Error)
+
+	assert.Equal(t, "job2", r.Jobs[1].Name)
+	assert.Equal(t, StatusSkipped, r.Jobs[1].Status)
+	assert.Equal(t, 0, len(r.Jobs[1].Tasks))
+
+	assert.Equal(t, "web1", r.Jobs[2].Host)
+	assert.Equal(t, "host web1 unreachable", r.Jobs[2].Error)
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := New(newTestFlow(t)).Write(&buf, FormatJSON)
+	assert.Nil(t, err)
+
+	r := &Report{}
+	err = json.Unmarshal(buf.Bytes(), r)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusFailed, r.Status)
+	assert.Equal(t, 3, len(r.Jobs))
+	assert.Equal(t, "task3", r.Jobs[0].Tasks[2].Name)
+	assert.Equal(t, map[string]interface{}{"key": "value"}, r.Jobs[0].Tasks[0].Result["map"])
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := New(newTestFlow(t)).Write(&buf, FormatJUnit)
+	assert.Nil(t, err)
+
+	suites := &junitTestSuites{}
+	err = xml.Unmarshal(buf.Bytes(), suites)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 5, suites.Tests)
+	assert.Equal(t, 2, suites.Failures)
+	assert.Equal(t, 2, suites.Skipped)
+	assert.Equal(t, 3, len(suites.Suites))
+
+	suite := suites.Suites[0]
+	assert.Equal(t, "job1@localhost", suite.Name)
+	assert.Equal(t, 3, len(suite.Cases))
+	assert.Equal(t, "job1.localhost", suite.Cases[0].Classname)
+	assert.Nil(t, suite.Cases[0].Failure)
+	assert.NotNil(t, suite.Cases[1].Skipped)
+	assert.Equal(t, "NOK | line1\nline2", suite.Cases[2].Failure.Message)
+
+	suite = suites.Suites[2]
+	assert.Equal(t, 1, len(suite.Cases))
+	assert.Equal(t, "job3", suite.Cases[0].Name)
+	assert.Equal(t, "host web1 unreachable", suite.Cases[0].Failure.Message)
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := New(newTestFlow(t)).Write(&buf, FormatMarkdown)
+	assert.Nil(t, err)
+
+	md := buf.String()
+	assert.Contains(t, md, "Status: **failed**")
+	assert.Contains(t, md, "Jobs: 0 success, 2 failed, 1 skipped")
+	assert.Contains(t, md, "| localhost | job1 | task3 | failed |")
+	assert.Contains(t, md, "NOK \\| line1<br>line2 |")
+	assert.Contains(t, md, "| localhost | job2 | - | skipped |")
+	assert.Contains(t, md, "| web1 | job3 | - | failed |")
+
+	// Table has the header, the separator and a row per task or job
+	assert.Equal(t, 2+5, strings.Count(md, "\n|"))
+}
+
+func TestWriteUnknownFormat(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := New(job.NewFlow()).Write(&buf, "yaml")
+	assert.NotNil(t, err)
+	assert.Nil(t, CheckFormat(FormatJUnit))
+}
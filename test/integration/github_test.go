@@ -243,7 +243,7 @@ func TestCmdRelease(t *testing.T) {
 				}
 			}
 
-			result := mygithub.CmdRelease(tc.params)
+			result := mygithub.CmdRelease(context.Background(), tc.params)
 			if assert.Nil(t, result.Error) {
 				// Check release
 				release := result.Result["release"].(*github.RepositoryRelease)
@@ -0,0 +1,270 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+/////////// DECLARATION OF ALL TYPES //////////////////////////
+
+const (
+	// Header is the first line of encrypted data
+	Header = "$JOBFLOW_VAULT;1.0;AES256"
+
+	saltSize  = 16
+	keySize   = 32
+	lineWidth = 80
+
+	// scrypt parameters used to derive the key from the password
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// Vault encrypts and decrypts data with AES-256-GCM using
+// a key derived from a password with scrypt.
+//
+// Encrypted data starts with the header line followed by
+// the base64 encoding of the salt, the nonce and the ciphertext.
+type Vault struct {
+	password []byte
+}
+
+///////// DECLARATION OF ALL GLOBAL VARIABLES ///////////
+
+// ErrDecrypt is returned when data cannot be decrypted
+// because the password is wrong or data are corrupted
+var ErrDecrypt = errors.New("vault: wrong password or corrupted data")
+
+////////// DEFINITION OF ALL FUNCTIONS ///////////////////////////
+
+// New returns a vault using the password given
+func New(password []byte) (*Vault, error) {
+	if len(password) == 0 {
+		return nil, errors.New("vault: empty password")
+	}
+
+	return &Vault{password: password}, nil
+}
+
+// ReadPasswordFile reads a password or a key from a file.
+// The ending new line is removed.
+func ReadPasswordFile(file string) ([]byte, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimRight(content, "\r\n"), nil
+}
+
+// IsEncrypted returns true if data are encrypted by a vault
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte(Header))
+}
+
+// IsEncryptedString returns true if the string is encrypted by a vault
+func IsEncryptedString(str string) bool {
+	return strings.HasPrefix(strings.TrimSpace(str), Header)
+}
+
+// Encrypt encrypts data
+func (v *Vault) Encrypt(plain []byte) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	_, err := io.ReadFull(rand.Reader, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := v.cipher(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := append(salt, nonce...)
+	payload = gcm.Seal(payload, nonce, plain, []byte(Header))
+
+	encoded := base64.StdEncoding.EncodeToString(payload)
+
+	var buf bytes.Buffer
+	buf.WriteString(Header + "\n")
+
+	for len(encoded) > 0 {
+		n := lineWidth
+		if n > len(encoded) {
+			n = len(encoded)
+		}
+
+		buf.WriteString(encoded[:n] + "\n")
+		encoded = encoded[n:]
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decrypt decrypts data encrypted by Encrypt
+func (v *Vault) Decrypt(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	if !bytes.HasPrefix(data, []byte(Header)) {
+		return nil, errors.New("vault: data not encrypted")
+	}
+
+	// Remove header and lines breaks, inline values
+	// may be indented in YAML files
+	encoded := strings.Join(strings.Fields(string(data[len(Header):])), "")
+
+	payload, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("vault: invalid encoding: %v", err)
+	}
+
+	if len(payload) < saltSize {
+		return nil, ErrDecrypt
+	}
+
+	gcm, err := v.cipher(payload[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+
+	payload = payload[saltSize:]
+	if len(payload) < gcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+
+	plain, err := gcm.Open(nil, payload[:gcm.NonceSize()], payload[gcm.NonceSize():], []byte(Header))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	return plain, nil
+}
+
+// EncryptString encrypts a string value
+func (v *Vault) EncryptString(str string) (string, error) {
+	data, err := v.Encrypt([]byte(str))
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// DecryptValue decrypts recursively all encrypted strings
+// in the value, which can be a map or a list of values
+func (v *Vault) DecryptValue(value interface{}) (interface{}, error) {
+	switch val := value.(type) {
+	case string:
+		if !IsEncryptedString(val) {
+			return val, nil
+		}
+
+		plain, err := v.Decrypt([]byte(val))
+		if err != nil {
+			return nil, err
+		}
+
+		return string(plain), nil
+	case []interface{}:
+		res := make([]interface{}, len(val))
+		for i, it := range val {
+			r, err := v.DecryptValue(it)
+			if err != nil {
+				return nil, err
+			}
+
+			res[i] = r
+		}
+
+		return res, nil
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(val))
+		for k, it := range val {
+			r, err := v.DecryptValue(it)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", k, err)
+			}
+
+			res[k] = r
+		}
+
+		return res, nil
+	case map[interface{}]interface{}:
+		res := make(map[interface{}]interface{}, len(val))
+		for k, it := range val {
+			r, err := v.DecryptValue(it)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", k, err)
+			}
+
+			res[k] = r
+		}
+
+		return res, nil
+	}
+
+	return value, nil
+}
+
+// HasEncrypted returns true if the value contains
+// an encrypted string, even in maps or lists
+func HasEncrypted(value interface{}) bool {
+	switch val := value.(type) {
+	case string:
+		return IsEncryptedString(val)
+	case []interface{}:
+		for _, it := range val {
+			if HasEncrypted(it) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, it := range val {
+			if HasEncrypted(it) {
+				return true
+			}
+		}
+	case map[interface{}]interface{}:
+		for _, it := range val {
+			if HasEncrypted(it) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+//////////////// INTERNAL FUNCTIONS ////////////////////
+
+// cipher returns the AES-256-GCM cipher using the key
+// derived from the password and the salt
+func (v *Vault) cipher(salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(v.password, salt, scryptN, scryptR, scryptP, keySize)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,92 @@
+package vault
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	v, err := New([]byte("password"))
+	assert.Nil(t, err)
+
+	plain := []byte("token: abc\npassword: def\n")
+
+	encrypted, err := v.Encrypt(plain)
+	assert.Nil(t, err)
+	assert.True(t, IsEncrypted(encrypted))
+	assert.False(t, strings.Contains(string(encrypted), "abc"))
+
+	// Salt and nonce are random
+	encrypted2, err := v.Encrypt(plain)
+	assert.Nil(t, err)
+	assert.NotEqual(t, encrypted, encrypted2)
+
+	decrypted, err := v.Decrypt(encrypted)
+	assert.Nil(t, err)
+	assert.Equal(t, plain, decrypted)
+
+	// Indented value as in a YAML block scalar
+	indented := "  " + strings.Replace(string(encrypted), "\n", "\n  ", -1)
+	decrypted, err = v.Decrypt([]byte(indented))
+	assert.Nil(t, err)
+	assert.Equal(t, plain, decrypted)
+
+	wrong, err := New([]byte("wrong"))
+	assert.Nil(t, err)
+
+	_, err = wrong.Decrypt(encrypted)
+	assert.Equal(t, ErrDecrypt, err)
+
+	_, err = v.Decrypt(plain)
+	assert.NotNil(t, err)
+
+	_, err = New(nil)
+	assert.NotNil(t, err)
+}
+
+func TestDecryptValue(t *testing.T) {
+	v, err := New([]byte("password"))
+	assert.Nil(t, err)
+
+	secret, err := v.EncryptString("secret")
+	assert.Nil(t, err)
+
+	value := map[string]interface{}{
+		"plain": "value",
+		"token": secret,
+		"list":  []interface{}{1, secret},
+		"map":   map[interface{}]interface{}{"pass": secret},
+	}
+
+	assert.True(t, HasEncrypted(value))
+
+	decrypted, err := v.DecryptValue(value)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"plain": "value",
+		"token": "secret",
+		"list":  []interface{}{1, "secret"},
+		"map":   map[interface{}]interface{}{"pass": "secret"},
+	}, decrypted)
+
+	assert.False(t, HasEncrypted(decrypted))
+}
+
+func TestReadPasswordFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobflow-vault")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "password")
+	err = ioutil.WriteFile(file, []byte("password\n"), 0600)
+	assert.Nil(t, err)
+
+	password, err := ReadPasswordFile(file)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("password"), password)
+}